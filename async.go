@@ -0,0 +1,215 @@
+package log
+
+import "io"
+import "fmt"
+import "sync"
+import "strings"
+import "sync/atomic"
+
+// asyncWriter queue log records in memory and write them to out from
+// a background goroutine, so that callers never wait on slow disks or
+// pipes. When the queue is full, overflow decides whether to block
+// the caller or drop records.
+type asyncWriter struct {
+	out       io.Writer
+	queuesize int
+	overflow  string   // "block", "dropnewest", "dropoldest", "droplevel"
+	droplevel LogLevel // drop records at this level or above, when full.
+	dropped   uint64   // atomic
+
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled on every change to queue or state.
+	queue   []asyncrecord
+	writing bool // a batch is being written to out.
+	closed  bool
+	done    chan struct{}
+}
+
+type asyncrecord struct {
+	level LogLevel
+	line  []byte
+}
+
+// newAsyncWriter reading "log.async.queuesize", "log.async.overflow"
+// and "log.async.droplevel" from setts.
+func newAsyncWriter(
+	out io.Writer, setts map[string]interface{}) (*asyncWriter, error) {
+
+	w := &asyncWriter{
+		out: out, queuesize: 1024, overflow: "block",
+		droplevel: LogLevelInfo, done: make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	queuesize, err := settingsize(setts, "log.async.queuesize")
+	if err != nil {
+		return nil, err
+	} else if queuesize > 0 {
+		w.queuesize = int(queuesize)
+	}
+	overflow, _ := setts["log.async.overflow"].(string)
+	if w.overflow, err = string2overflow(overflow); err != nil {
+		return nil, err
+	}
+	if droplevel, _ := setts["log.async.droplevel"].(string); droplevel != "" {
+		if w.droplevel, err = ParseLevel(droplevel); err != nil {
+			return nil, err
+		}
+	}
+	w.queue = make([]asyncrecord, 0, w.queuesize)
+
+	go w.drain()
+	return w, nil
+}
+
+func string2overflow(s string) (string, error) {
+	switch s = strings.ToLower(s); s {
+	case "", "block":
+		return "block", nil
+	case "dropnewest", "dropoldest", "droplevel":
+		return s, nil
+	}
+	return "", fmt.Errorf("unexpected overflow %q", s)
+}
+
+// Write implement io.Writer, p is treated as an info level record.
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+	return w.writelevel(LogLevelInfo, line)
+}
+
+// writelevel queue line without copying, caller shall not reuse line.
+func (w *asyncWriter) writelevel(level LogLevel, line []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && len(w.queue) >= w.queuesize {
+		switch w.overflow {
+		case "dropnewest":
+			atomic.AddUint64(&w.dropped, 1)
+			return len(line), nil
+
+		case "dropoldest":
+			atomic.AddUint64(&w.dropped, 1)
+			w.queue = append(w.queue[:0], w.queue[1:]...)
+			continue
+
+		case "droplevel":
+			if level >= w.droplevel {
+				atomic.AddUint64(&w.dropped, 1)
+				return len(line), nil
+			}
+		}
+		w.cond.Wait()
+	}
+	if w.closed { // write synchronously after close, once drained.
+		w.mu.Unlock()
+		<-w.done
+		w.mu.Lock()
+		return w.out.Write(line)
+	}
+	w.queue = append(w.queue, asyncrecord{level: level, line: line})
+	w.cond.Broadcast()
+	return len(line), nil
+}
+
+// drain queue in batches until closed.
+func (w *asyncWriter) drain() {
+	batch := make([]asyncrecord, 0, w.queuesize)
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 && w.closed {
+			w.mu.Unlock()
+			close(w.done)
+			return
+		}
+		batch, w.queue = w.queue, batch[:0]
+		w.writing = true
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		for i, r := range batch {
+			w.out.Write(r.line)
+			batch[i].line = nil
+		}
+
+		w.mu.Lock()
+		w.writing = false
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+// Flush wait until all queued records are written to out.
+func (w *asyncWriter) Flush() error {
+	w.mu.Lock()
+	for len(w.queue) > 0 || w.writing {
+		w.cond.Wait()
+	}
+	w.mu.Unlock()
+	return nil
+}
+
+// Close drain the queue and stop the background goroutine, records
+// written after Close are written synchronously, after the queue is
+// drained.
+func (w *asyncWriter) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+	return nil
+}
+
+// Dropped return the number of records dropped due to overflow.
+func (w *asyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Flush for defaultLogger, wait until all queued records are written,
+// a no-op if logger is not configured with "log.async".
+func (l *defaultLogger) Flush() error {
+	for _, s := range l.sinks {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dropped for defaultLogger, return the number of records dropped
+// because the queue was full, or a stream sink could neither reach
+// its collector nor spool the record.
+func (l *defaultLogger) Dropped() uint64 {
+	dropped := uint64(0)
+	for _, s := range l.sinks {
+		dropped += s.dropped()
+	}
+	return dropped
+}
+
+// Flush wait until all records queued by the default logger are
+// written. Custom loggers can support Flush by implementing a
+// Flush() error method.
+func Flush() error {
+	if logger, ok := getlog().(interface{ Flush() error }); ok {
+		return logger.Flush()
+	}
+	return nil
+}
+
+// Dropped return the number of records dropped by the default logger
+// because its queue was full, or its stream sink was down. Custom
+// loggers can support Dropped by implementing a Dropped() uint64
+// method.
+func Dropped() uint64 {
+	if logger, ok := getlog().(interface{ Dropped() uint64 }); ok {
+		return logger.Dropped()
+	}
+	return 0
+}
@@ -0,0 +1,175 @@
+package log
+
+import "sync"
+import "bytes"
+import "strings"
+import "testing"
+import "sync/atomic"
+
+// gatedWriter blocks all writes until gate is closed.
+type gatedWriter struct {
+	gate chan struct{}
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.Write(p)
+}
+
+func (g *gatedWriter) String() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.String()
+}
+
+// fillAsync write first record and wait for the background goroutine
+// to block on it, then fill the queue.
+func fillAsync(t *testing.T, w *asyncWriter, level LogLevel, lines ...string) {
+	w.writelevel(level, []byte(lines[0]))
+	waitfor(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.writing
+	})
+	for _, line := range lines[1:] {
+		w.writelevel(level, []byte(line))
+	}
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	testcases := []struct {
+		overflow string
+		level    LogLevel
+		ref      string
+		dropped  uint64
+	}{
+		{"dropnewest", LogLevelInfo, "a\nb\nc\n", 2},
+		{"dropoldest", LogLevelInfo, "a\nd\ne\n", 2},
+		{"droplevel", LogLevelDebug, "a\nb\nc\n", 2},
+	}
+	for _, tc := range testcases {
+		out := &gatedWriter{gate: make(chan struct{})}
+		setts := map[string]interface{}{
+			"log.async.queuesize": 2, "log.async.overflow": tc.overflow,
+			"log.async.droplevel": "debug",
+		}
+		w, err := newAsyncWriter(out, setts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fillAsync(t, w, tc.level, "a\n", "b\n", "c\n", "d\n", "e\n")
+		close(out.gate)
+		w.Close()
+		if s := out.String(); s != tc.ref {
+			t.Errorf("%v expected %q, got %q", tc.overflow, tc.ref, s)
+		} else if n := w.Dropped(); n != tc.dropped {
+			t.Errorf("%v expected %v, got %v", tc.overflow, tc.dropped, n)
+		}
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	out := &gatedWriter{gate: make(chan struct{})}
+	setts := map[string]interface{}{
+		"log.async.queuesize": 2, "log.async.overflow": "droplevel",
+		"log.async.droplevel": "debug",
+	}
+	w, err := newAsyncWriter(out, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillAsync(t, w, LogLevelInfo, "a\n", "b\n", "c\n")
+
+	// error level is above droplevel, hence it should block until the
+	// queue is drained, which needs the gate.
+	var released int32
+	startch, donech := make(chan struct{}), make(chan struct{})
+	go func() {
+		close(startch)
+		w.writelevel(LogLevelError, []byte("d\n"))
+		if atomic.LoadInt32(&released) == 0 {
+			t.Errorf("expected writer to block")
+		}
+		close(donech)
+	}()
+	<-startch
+	atomic.StoreInt32(&released, 1)
+	close(out.gate)
+	<-donech
+	w.Flush()
+	if s, ref := out.String(), "a\nb\nc\nd\n"; s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+	w.Close()
+	w.Write([]byte("e\n")) // after close
+	if s := out.String(); !strings.HasSuffix(s, "d\ne\n") {
+		t.Errorf("unexpected %q", s)
+	}
+}
+
+func TestAsyncWriteAfterClose(t *testing.T) {
+	out := &gatedWriter{gate: make(chan struct{})}
+	w, err := newAsyncWriter(out, map[string]interface{}{"log.async.queuesize": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillAsync(t, w, LogLevelInfo, "a\n", "b\n", "c\n")
+
+	closech := make(chan struct{})
+	go func() {
+		w.Close()
+		close(closech)
+	}()
+	waitfor(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.closed
+	})
+	// shall wait for queued records, instead of racing with drain.
+	startch, donech := make(chan struct{}), make(chan struct{})
+	go func() {
+		close(startch)
+		w.Write([]byte("d\n"))
+		select {
+		case <-w.done:
+		default:
+			t.Errorf("expected write to wait for drain")
+		}
+		close(donech)
+	}()
+	<-startch
+	close(out.gate)
+	<-closech
+	<-donech
+	if s, ref := out.String(), "a\nb\nc\nd\n"; s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+}
+
+func TestAsyncLogger(t *testing.T) {
+	var buf bytes.Buffer
+	setts := map[string]interface{}{
+		"log.level": "info", "log.timeformat": "", "log.async": true,
+	}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	for i := 0; i < 100; i++ {
+		Infof("line %v", i)
+	}
+	Flush()
+	if n := strings.Count(buf.String(), "\n"); n != 100 {
+		t.Errorf("expected %v, got %v", 100, n)
+	} else if n := Dropped(); n != 0 {
+		t.Errorf("unexpected dropped %v", n)
+	}
+	logger.(*defaultLogger).Close()
+}
@@ -1,5 +1,10 @@
 package log
 
+import "fmt"
+import "sort"
+import "time"
+import "strings"
+
 /*
 Defaultsettings used on default logger.
 
@@ -8,6 +13,36 @@ log.level: (default "info")
 	"ignore", "fatal", "error", "warn", "info", "verbose",
 	"debug", "trace".
 
+log.levels: (default "")
+    Comma separated list of prefix=level, setting level for loggers
+    created using Named(), like "storage=debug,storage.wal=trace".
+    A rule applies to loggers named prefix or named prefix followed by
+    "." and more components, longest prefix wins, loggers not matching
+    any rule log at log.level. Rules can also be supplied as separate
+    parameters, like "log.levels.storage": "debug".
+
+log.v: (default 0)
+    Verbosity for V(), V(n) logs if n is within log.v. Verbosity is
+    also implied by log.level, 1 for "verbose", 2 for "debug" and
+    unlimited for "trace".
+
+log.vmodule: (default "")
+    Comma separated list of pattern=N, raising verbosity to N for
+    source files matching pattern, like "wal=3,storage/*=2". Patterns
+    without "/" match the file name, patterns with "/" match as many
+    trailing path components, without ".go" extension.
+
+log.debugsites: (default false)
+    Track Debugf/Tracef call sites, refer DebugSites(). Call sites are
+    also tracked while there are log.debugrules, and forgotten when
+    log.debugsites or log.debugrules are configured.
+
+log.debugrules: (default "")
+    Dynamic debug rules separated by ";", enabling matching
+    Debugf/Tracef call sites irrespective of log.level, like
+    "file=storage/wal.go line=10-40; func=Replay format=segment".
+    Refer EnableDebug() for rule syntax.
+
 log.flags: (default "")
     Flags can be comma seperated string values. These flags as exactly
     same as the golang's standard logger.
@@ -23,12 +58,149 @@ log.file: (default os.Stdout)
     Optional log file name to log o/p. Except Consolef all functions
     will o/p to this file if supplied, else to standard output.
 
+    If log.file contains strftime style conversions, like
+    "app-%Y%m%d-%H.log", a new file is created every time the clock
+    crosses log.file.interval. Supported conversions are %Y, %y, %m,
+    %d, %j, %H, %M, %S and %%.
+
+log.file.interval: (default "")
+    Can be "hourly" or "daily", if empty, it is "hourly" if log.file
+    contains %H, else "daily".
+
+log.file.timezone: (default "Local")
+    Time zone for log.file pattern and interval boundaries, can be
+    "UTC", "Local" or an IANA time zone name like "Asia/Kolkata".
+
+log.file.symlink: (default "")
+    If not empty, maintain a symlink by this name pointing to the
+    active log file. Relative names are resolved from log.file's
+    directory.
+
+log.file.maxsize: (default 0)
+    Rotate log.file once its size reaches maxsize bytes, can be an
+    integer or a string with "KB", "MB" or "GB" suffix. The file is
+    renamed to a backup named "<name>-<timestamp><ext>", and a fresh
+    file is created. Zero disables rotation.
+
+log.file.maxbackups: (default 0)
+    Maximum number of rotated backups to retain, zero retains all.
+
+log.file.maxage: (default "")
+    Remove rotated backups older than maxage, should confirm to
+    time.ParseDuration(), like "168h". Empty string retains all.
+
+log.file.maxtotalsize: (default 0)
+    Remove oldest backups once the total size of all backups exceeds
+    maxtotalsize, can be an integer or a string with "KB", "MB" or "GB"
+    suffix. Zero disables the quota.
+
+log.file.compress: (default false)
+    Gzip compress rotated backups in the background, compressed
+    backups are named "<backup>.gz".
+
+log.file.reopensignal: (default "")
+    Reopen log.file on receiving this signal, can be "SIGHUP", "SIGUSR1"
+    or "SIGUSR2". Useful with external tools like logrotate that
+    rename the log file. Refer Reopen() to do the same from code.
+
+log.sinks: (default "")
+    Comma separated list of sink names, like "console,file". If not
+    empty, records are written to every listed sink, instead of
+    log.file or standard output. Each sink is configured by,
+
+    log.sinks.<name>.writer: "stdout", "stderr", "file", "syslog",
+    "journald", "stream", or an io.Writer, default is the writer passed
+    to New(), else "stdout".
+    log.sinks.<name>.file: log file name, implies "file" writer,
+    rotated as per log.file.* parameters.
+    log.sinks.<name>.minlevel: least severe level to log, like
+    log.level, default "trace".
+    log.sinks.<name>.maxlevel: most severe level to log, default
+    "fatal". Records are first filtered by log.level.
+    log.sinks.<name>.format: "text", "json" or "logfmt", default is
+    log.format.
+    log.sinks.<name>.color: use log.color* attributes, default true
+    for "stdout" and "stderr" writers.
+    log.sinks.<name>.async: queue records for this sink, default is
+    log.async, queue is configured by log.async.* parameters.
+
+    Sinks with "syslog" writer are further configured by,
+
+    log.sinks.<name>.network: "udp", "tcp", "unix" or "unixgram", if
+    empty, local syslog daemon at /dev/log is used.
+    log.sinks.<name>.address: syslog daemon address, like
+    "localhost:514", or socket path for local syslog.
+    log.sinks.<name>.facility: like "daemon" or "local0", default
+    "user".
+    log.sinks.<name>.appname: default is program name.
+    log.sinks.<name>.protocol: "rfc5424", default, or "rfc3164".
+    Refer SyslogSeverity() for mapping log levels to severities.
+
+    Sinks with "journald" writer accept "address", default
+    "/run/systemd/journal/socket", and "appname" for
+    SYSLOG_IDENTIFIER.
+
+    Sinks with "stream" writer send newline delimited JSON records to
+    a collector, like Fluent Bit or Vector, and are configured by,
+
+    log.sinks.<name>.network: "tcp", default, or "unix".
+    log.sinks.<name>.address: collector address, like
+    "localhost:24224", or socket path, required.
+    log.sinks.<name>.tls: connect using TLS, implied by tlsca,
+    tlscert and tlskey.
+    log.sinks.<name>.tlsca: PEM file to verify collector, default is
+    system roots.
+    log.sinks.<name>.tlscert, log.sinks.<name>.tlskey: PEM files for
+    client certificate.
+    log.sinks.<name>.tlsservername: default is host of address,
+    required over unix.
+    log.sinks.<name>.maxbackoff: upper bound for reconnect backoff,
+    that starts at 100ms and doubles, default "30s".
+    log.sinks.<name>.spool: directory to spool records while the
+    collector is not connected, replayed in order on reconnect. If
+    empty, such records are dropped, refer Dropped(). Collector is
+    connected in the background.
+    log.sinks.<name>.spoolsize: size cap on spool, oldest records are
+    dropped beyond it, default "64MB".
+
+log.async: (default false)
+    Queue log records in memory and write them from a background
+    goroutine. Use Flush() to wait for queued records to be written.
+
+log.async.queuesize: (default 1024)
+    Maximum number of records queued in "log.async" mode.
+
+log.async.overflow: (default "block")
+    What to do when the queue is full, can be one of,
+    "block" wait for the queue to drain.
+    "dropnewest" drop the record being logged.
+    "dropoldest" drop the oldest queued record.
+    "droplevel" drop records at log.async.droplevel or above, and wait
+    for the queue to drain for other records.
+    Use Dropped() to get the number of dropped records.
+
+log.async.droplevel: (default "info")
+    Log level for "droplevel" overflow.
+
 log.timeformat: "2006-01-02T15:04:05.999Z-07:00"
-	Log line timeformat.
+	Log line timeformat. Records in "json" and "logfmt" format use
+	RFC3339Nano, unless timeformat is changed from its default.
 
 log.prefix: [%v]
 	Prefix format for log-level.
 
+log.format: "text"
+	Output format for log records, can be "text", "json" or "logfmt".
+	In "json" format every record is logged as a single line JSON
+	object with "time", "level", "msg", "caller" and fields. In
+	"logfmt" format every record is logged as a line of key=value
+	pairs starting with ts, level, msg and caller. For both "json" and
+	"logfmt" log.flags, log.prefix and color attributes are ignored.
+
+log.levelname: "short"
+	Names used for log levels, "short" uses the five letter names like
+	"Infom", "Warng", "full" uses names like "info", "warn".
+
 log.colorfatal: "red"
 	Output color for fatal level.
 
@@ -52,19 +224,290 @@ log.colortrace: "",
 */
 func Defaultsettings() map[string]interface{} {
 	setts := map[string]interface{}{
-		"log.level":        "info",
-		"log.flags":        "",
-		"log.file":         "",
-		"log.timeformat":   timeformat,
-		"log.prefix":       prefix,
-		"log.colorignore":  "",
-		"log.colorfatal":   "red",
-		"log.colorerror":   "hired",
-		"log.colorwarn":    "yellow",
-		"log.colorinfo":    "",
-		"log.colorverbose": "",
-		"log.colordebug":   "",
-		"log.colortrace":   "",
+		"log.level":             "info",
+		"log.levels":            "",
+		"log.v":                 0,
+		"log.vmodule":           "",
+		"log.debugsites":        false,
+		"log.debugrules":        "",
+		"log.flags":             "",
+		"log.file":              "",
+		"log.file.maxsize":      0,
+		"log.file.maxbackups":   0,
+		"log.file.maxage":       "",
+		"log.file.maxtotalsize": 0,
+		"log.file.compress":     false,
+		"log.file.interval":     "",
+		"log.file.timezone":     "Local",
+		"log.file.reopensignal": "",
+		"log.file.symlink":      "",
+		"log.sinks":             "",
+		"log.async":             false,
+		"log.async.queuesize":   1024,
+		"log.async.overflow":    "block",
+		"log.async.droplevel":   "info",
+		"log.timeformat":        timeformat,
+		"log.prefix":            prefix,
+		"log.format":            "text",
+		"log.levelname":         "short",
+		"log.colorignore":       "",
+		"log.colorfatal":        "red",
+		"log.colorerror":        "hired",
+		"log.colorwarn":         "yellow",
+		"log.colorinfo":         "",
+		"log.colorverbose":      "",
+		"log.colordebug":        "",
+		"log.colortrace":        "",
 	}
 	return setts
 }
+
+// ConfigError lists every invalid parameter found in logger settings.
+type ConfigError struct {
+	Errs []error
+}
+
+func (err *ConfigError) Error() string {
+	ss := make([]string, 0, len(err.Errs))
+	for _, e := range err.Errs {
+		ss = append(ss, e.Error())
+	}
+	return "invalid log settings: " + strings.Join(ss, "; ")
+}
+
+type checker func(setts map[string]interface{}, key string) error
+
+// checkers for every parameter accepted by New(), unknown parameters
+// with "log." prefix are rejected.
+var checkers = map[string]checker{
+	"log.level":             checklevel,
+	"log.levels":            checklevels,
+	"log.v":                 checkv,
+	"log.vmodule":           checkvmodule,
+	"log.debugsites":        checkbool,
+	"log.debugrules":        checkdebugrules,
+	"log.flags":             checkflags,
+	"log.file":              checkstring,
+	"log.file.maxsize":      checksize,
+	"log.file.maxbackups":   checksize,
+	"log.file.maxage":       checkduration,
+	"log.file.maxtotalsize": checksize,
+	"log.file.compress":     checkbool,
+	"log.file.interval":     checkinterval,
+	"log.file.timezone":     checktimezone,
+	"log.file.symlink":      checkstring,
+	"log.file.reopensignal": checksignal,
+	"log.sinks":             checksinks,
+	"log.async":             checkbool,
+	"log.async.queuesize":   checksize,
+	"log.async.overflow":    checkoverflow,
+	"log.async.droplevel":   checklevel,
+	"log.timeformat":        checkstring,
+	"log.prefix":            checkprefix,
+	"log.format":            checkformat,
+	"log.levelname":         checklevelname,
+	"log.colorignore":       checkcolor,
+	"log.colorfatal":        checkcolor,
+	"log.colorerror":        checkcolor,
+	"log.colorwarn":         checkcolor,
+	"log.colorinfo":         checkcolor,
+	"log.colorverbose":      checkcolor,
+	"log.colordebug":        checkcolor,
+	"log.colortrace":        checkcolor,
+}
+
+// validate every parameter in setts, return a *ConfigError listing
+// all the problems, sorted by parameter name.
+func validate(setts map[string]interface{}) error {
+	keys := make([]string, 0, len(setts))
+	for key := range setts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := []error{}
+	for _, key := range keys {
+		if check, ok := checkers[key]; ok {
+			if err := check(setts, key); err != nil {
+				errs = append(errs, err)
+			}
+		} else if strings.HasPrefix(key, "log.levels.") {
+			if err := checklevels(setts, key); err != nil {
+				errs = append(errs, err)
+			}
+		} else if strings.HasPrefix(key, "log.sinks.") {
+			if err := checksink(setts, key); err != nil {
+				errs = append(errs, err)
+			}
+		} else if strings.HasPrefix(key, "log.") {
+			errs = append(errs, fmt.Errorf("unknown parameter %q", key))
+		}
+	}
+	if len(errs) > 0 {
+		return &ConfigError{Errs: errs}
+	}
+	return nil
+}
+
+func checkstring(setts map[string]interface{}, key string) error {
+	_, err := settingstring(setts, key)
+	return err
+}
+
+func checksize(setts map[string]interface{}, key string) error {
+	_, err := settingsize(setts, key)
+	return err
+}
+
+func checkduration(setts map[string]interface{}, key string) error {
+	_, err := settingduration(setts, key)
+	return err
+}
+
+func checkbool(setts map[string]interface{}, key string) error {
+	_, err := settingbool(setts, key)
+	return err
+}
+
+func checklevel(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		if s == "" && key != "log.level" {
+			return nil
+		}
+		_, err := ParseLevel(s)
+		return err
+	})
+}
+
+// checklevels validate "log.levels" and "log.levels.<prefix>".
+func checklevels(setts map[string]interface{}, key string) error {
+	if _, err := levelrules(map[string]interface{}{key: setts[key]}); err != nil {
+		return fmt.Errorf("invalid value for %q: %v", key, err)
+	}
+	return nil
+}
+
+func checkv(setts map[string]interface{}, key string) error {
+	if v, err := settingsize(setts, key); err != nil {
+		return err
+	} else if v < 0 {
+		return fmt.Errorf("invalid value for %q: negative verbosity", key)
+	}
+	return nil
+}
+
+func checkvmodule(setts map[string]interface{}, key string) error {
+	items, err := settingcsv(setts, key)
+	if err != nil {
+		return err
+	} else if _, err := parsevmodule(items); err != nil {
+		return fmt.Errorf("invalid value for %q: %v", key, err)
+	}
+	return nil
+}
+
+func checkdebugrules(setts map[string]interface{}, key string) error {
+	specs, err := settingrules(setts, key)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if _, err := parsedebugrule(spec); err != nil {
+			return fmt.Errorf("invalid value for %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func checkflags(setts map[string]interface{}, key string) error {
+	flags, err := settingcsv(setts, key)
+	if err != nil {
+		return err
+	}
+	for _, flag := range flags {
+		if _, err := string2flag(flag); err != nil {
+			return fmt.Errorf("invalid value for %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func checkinterval(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		_, err := string2interval(s, "")
+		return err
+	})
+}
+
+func checktimezone(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		_, err := time.LoadLocation(s)
+		return err
+	})
+}
+
+func checksignal(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		if s == "" {
+			return nil
+		}
+		_, err := string2signal(s)
+		return err
+	})
+}
+
+func checkoverflow(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		_, err := string2overflow(s)
+		return err
+	})
+}
+
+func checkformat(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		_, err := string2format(s)
+		return err
+	})
+}
+
+func checklevelname(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		_, err := string2levelname(s)
+		return err
+	})
+}
+
+func checkprefix(setts map[string]interface{}, key string) error {
+	switch setts[key].(type) {
+	case string, bool:
+		return nil
+	}
+	fmsg := "invalid type: parameter %q has %T, expected string or bool"
+	return fmt.Errorf(fmsg, key, setts[key])
+}
+
+func checkcolor(setts map[string]interface{}, key string) error {
+	attrs, err := settingcsv(setts, key)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		if _, err := string2clrattr(attr); err != nil {
+			return fmt.Errorf("invalid value for %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// checkstringwith validate string value for key using fn.
+func checkstringwith(
+	setts map[string]interface{}, key string, fn func(string) error) error {
+
+	s, err := settingstring(setts, key)
+	if err != nil {
+		return err
+	} else if err := fn(s); err != nil {
+		return fmt.Errorf("invalid value for %q: %v", key, err)
+	}
+	return nil
+}
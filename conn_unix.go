@@ -0,0 +1,42 @@
+//go:build !windows
+
+package log
+
+import "net"
+import "syscall"
+import "crypto/tls"
+
+// connclosed return whether the peer has closed or reset conn, by
+// peeking into the socket without blocking. Writes on a connection
+// closed by peer succeed until the peer's reset arrives, losing the
+// record, hence stream connections are checked before every write.
+// TLS connections are not peeked, TLS records are opaque, their write
+// errors trigger reconnect.
+func connclosed(conn net.Conn) bool {
+	if _, ok := conn.(*tls.Conn); ok {
+		return false
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	closed := false
+	raw.Read(func(fd uintptr) bool {
+		var buf [1]byte
+		flags := syscall.MSG_PEEK | syscall.MSG_DONTWAIT
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], flags)
+		switch err {
+		case nil:
+			closed = n == 0 // end of stream.
+		case syscall.EAGAIN, syscall.EINTR:
+		default:
+			closed = true
+		}
+		return true
+	})
+	return closed
+}
@@ -0,0 +1,170 @@
+package log
+
+import "fmt"
+import "sync"
+import "context"
+import "strings"
+import "sync/atomic"
+
+type loggerkey struct{}
+
+type traceparentkey struct{}
+
+// Extractor return fields to be attached to every record logged using
+// a logger obtained by FromContext(), typically picked from values
+// carried by ctx, like request-id.
+type Extractor func(ctx context.Context) []Field
+
+var extractors atomic.Value // []Extractor, copy-on-write.
+var extractormu sync.Mutex  // serialize RegisterExtractor.
+
+func init() {
+	extractors.Store([]Extractor{TraceparentExtractor})
+}
+
+// RegisterExtractor add an extractor, applied by FromContext() in the
+// order of registration, after TraceparentExtractor that is
+// registered by default.
+func RegisterExtractor(extractor Extractor) {
+	extractormu.Lock()
+	defer extractormu.Unlock()
+
+	olds := extractors.Load().([]Extractor)
+	news := make([]Extractor, 0, len(olds)+1)
+	news = append(append(news, olds...), extractor)
+	extractors.Store(news)
+}
+
+// IntoContext return a copy of ctx carrying logger, refer FromContext().
+func IntoContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerkey{}, logger)
+}
+
+// FromContext return logger carried by ctx, or the default logger,
+// with fields from registered extractors attached, like:
+//
+//	log.FromContext(ctx).Infof("served %v", path)
+//
+// Extractors are applied on every call, hence do not store the
+// returned logger back into ctx, that would duplicate the fields.
+func FromContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return getlog()
+	}
+	logger, ok := ctx.Value(loggerkey{}).(Logger)
+	if !ok {
+		logger = getlog()
+	}
+	fields := contextfields(nil, ctx)
+	if len(fields) == 0 {
+		return logger
+	}
+	keyvals := make([]interface{}, 0, len(fields)*2)
+	for _, field := range fields {
+		keyvals = append(keyvals, field.Key, field.Value)
+	}
+	return logger.With(keyvals...)
+}
+
+// contextfields append fields from all registered extractors.
+func contextfields(fields []Field, ctx context.Context) []Field {
+	for _, extractor := range extractors.Load().([]Extractor) {
+		fields = append(fields, extractor(ctx)...)
+	}
+	return fields
+}
+
+// Traceparent is W3C trace-context carried by "traceparent" header.
+type Traceparent struct {
+	Version string // 2 hex digits
+	TraceID string // 32 hex digits
+	SpanID  string // 16 hex digits, also called parent-id.
+	Flags   string // 2 hex digits
+}
+
+// Sampled return whether the sampled flag is set.
+func (tp Traceparent) Sampled() bool {
+	return len(tp.Flags) == 2 && hexval(tp.Flags[1])&1 == 1
+}
+
+// String return tp formatted as "traceparent" header value.
+func (tp Traceparent) String() string {
+	return tp.Version + "-" + tp.TraceID + "-" + tp.SpanID + "-" + tp.Flags
+}
+
+// ParseTraceparent parse W3C "traceparent" header value, like
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(s string) (Traceparent, error) {
+	tp := Traceparent{}
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 {
+		return tp, fmt.Errorf("invalid traceparent %q", s)
+	}
+	tp.Version, tp.TraceID, tp.SpanID, tp.Flags =
+		parts[0], parts[1], parts[2], parts[3]
+	switch {
+	case !ishex(tp.Version, 2) || tp.Version == "ff":
+		return tp, fmt.Errorf("invalid traceparent version %q", tp.Version)
+	case tp.Version == "00" && len(parts) != 4:
+		return tp, fmt.Errorf("invalid traceparent %q", s)
+	case !ishex(tp.TraceID, 32) || strings.Trim(tp.TraceID, "0") == "":
+		return tp, fmt.Errorf("invalid trace-id %q", tp.TraceID)
+	case !ishex(tp.SpanID, 16) || strings.Trim(tp.SpanID, "0") == "":
+		return tp, fmt.Errorf("invalid parent-id %q", tp.SpanID)
+	case !ishex(tp.Flags, 2):
+		return tp, fmt.Errorf("invalid trace-flags %q", tp.Flags)
+	}
+	return tp, nil
+}
+
+// WithTraceparent return a copy of ctx carrying trace-context parsed
+// from W3C "traceparent" header value, to be picked by
+// TraceparentExtractor. If s is invalid ctx is returned as is, along
+// with the error, as required by the spec.
+func WithTraceparent(ctx context.Context, s string) (context.Context, error) {
+	tp, err := ParseTraceparent(s)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, traceparentkey{}, tp), nil
+}
+
+// TraceparentFromContext return trace-context carried by ctx, refer
+// WithTraceparent().
+func TraceparentFromContext(ctx context.Context) (Traceparent, bool) {
+	tp, ok := ctx.Value(traceparentkey{}).(Traceparent)
+	return tp, ok
+}
+
+// TraceparentExtractor attach "trace_id" and "span_id" fields from
+// trace-context carried by ctx, refer WithTraceparent().
+func TraceparentExtractor(ctx context.Context) []Field {
+	tp, ok := TraceparentFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []Field{
+		{Key: "trace_id", Value: tp.TraceID}, {Key: "span_id", Value: tp.SpanID},
+	}
+}
+
+// ishex return whether s is n lower case hex digits.
+func ishex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func hexval(c byte) byte {
+	if c >= 'a' {
+		return c - 'a' + 10
+	}
+	return c - '0'
+}
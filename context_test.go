@@ -0,0 +1,104 @@
+package log
+
+import "bytes"
+import "context"
+import "testing"
+import "log/slog"
+
+type reqidkey struct{}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	setts := map[string]interface{}{"log.level": "info", "log.timeformat": ""}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	olds := extractors.Load().([]Extractor)
+	defer extractors.Store(olds)
+	RegisterExtractor(func(ctx context.Context) []Field {
+		if reqid, ok := ctx.Value(reqidkey{}).(string); ok {
+			return []Field{{Key: "reqid", Value: reqid}}
+		}
+		return nil
+	})
+
+	// without context values, default logger as is.
+	ctx := context.Background()
+	if FromContext(ctx) != logger {
+		t.Errorf("expected default logger")
+	}
+	FromContext(ctx).Infof("plain")
+
+	ctx = context.WithValue(ctx, reqidkey{}, "r1")
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if ctx, err = WithTraceparent(ctx, tp); err != nil {
+		t.Fatal(err)
+	}
+	FromContext(ctx).Infow("served", "code", 200)
+
+	// logger carried by context.
+	ctx = IntoContext(ctx, logger.With("svc", "api"))
+	FromContext(ctx).Warnf("slow")
+
+	// slog handler picks extractors from context.
+	slog.New(NewSlogHandler(nil)).InfoContext(ctx, "via slog")
+
+	refs := "[Infom] plain\n" +
+		"[Infom] served trace_id=4bf92f3577b34da6a3ce929d0e0e4736 " +
+		"span_id=00f067aa0ba902b7 reqid=r1 code=200\n" +
+		"[Warng] slow svc=api trace_id=4bf92f3577b34da6a3ce929d0e0e4736 " +
+		"span_id=00f067aa0ba902b7 reqid=r1\n" +
+		"[Infom] via slog trace_id=4bf92f3577b34da6a3ce929d0e0e4736 " +
+		"span_id=00f067aa0ba902b7 reqid=r1\n"
+	if s := buf.String(); s != refs {
+		t.Errorf("expected %q, got %q", refs, s)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tp, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	} else if tp.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected %v", tp.TraceID)
+	} else if tp.SpanID != "00f067aa0ba902b7" || !tp.Sampled() {
+		t.Errorf("unexpected %+v", tp)
+	} else if s := tp.String(); s != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("unexpected %v", s)
+	}
+
+	// future versions can carry more fields.
+	s := "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-xyz"
+	if tp, err := ParseTraceparent(s); err != nil {
+		t.Error(err)
+	} else if tp.Sampled() {
+		t.Errorf("unexpected sampled")
+	}
+
+	bad := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	}
+	for _, s := range bad {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+		ctx, err := WithTraceparent(context.Background(), s)
+		if err == nil {
+			t.Errorf("expected error for %q", s)
+		} else if _, ok := TraceparentFromContext(ctx); ok {
+			t.Errorf("unexpected trace-context for %q", s)
+		}
+	}
+}
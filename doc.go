@@ -20,6 +20,8 @@ logger:
 		"log.file":         "",
 		"log.timeformat":   timeformat,
 		"log.prefix":       prefix,
+		"log.format":       "text",
+		"log.levelname":    "short",
 		"log.colorignore":  "",
 		"log.colorfatal":   "red",
 		"log.colorerror":   "hired",
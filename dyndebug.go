@@ -0,0 +1,406 @@
+package log
+
+import "fmt"
+import "path"
+import "sort"
+import "sync"
+import "strconv"
+import "strings"
+import "runtime"
+import "sync/atomic"
+
+// debuggen is bumped for every new set of debug rules, such that
+// call sites re-evaluate rules lazily.
+var debuggen uint64
+
+// DebugSite is a Debugf/Tracef, or Debugw/Tracew, call site that was
+// hit while dynamic debug was active, refer DebugSites().
+type DebugSite struct {
+	File    string
+	Line    int
+	Func    string
+	Format  string
+	Level   LogLevel
+	Enabled bool   // enabled by a debug rule.
+	Hits    uint64 // number of calls.
+}
+
+type debugsite struct {
+	DebugSite // File, Line, Func, Format and Level are immutable.
+
+	state uint64 // atomic, rules generation << 1 | enabled bit.
+	hits  uint64 // atomic
+}
+
+// dyndebug is never modified once stored in logconfig.
+type dyndebug struct {
+	gen   uint64
+	track bool // track call sites even without rules.
+	rules []debugrule
+	sites *debugsites
+}
+
+// debugsites registry, populated while dynamic debug is active. It is
+// shared by EnableDebug() and DisableDebug() updates, and replaced when
+// "log.debugsites" or "log.debugrules" are configured.
+type debugsites struct {
+	sites sync.Map // "file:line" -> *debugsite
+	// program counter -> *debugsite, a call site can have several
+	// program counters when inlined.
+	pcs sync.Map
+}
+
+// debugrule match call sites, all supplied terms shall match.
+type debugrule struct {
+	spec           string // normalized rule.
+	file, function string // path.Match patterns.
+	format         string // substring.
+	minline        int
+	maxline        int
+}
+
+// EnableDebug add a dynamic debug rule to the default logger, enabling
+// Debugf/Tracef call sites matching the rule irrespective of log
+// level. Rule is a space separated list of terms, all of which shall
+// match:
+//
+//	file=<glob>      source file, like "wal.go" or "storage/*"
+//	line=<n>[-<m>]   line number or range
+//	func=<glob>      function name, like "Replay" or "(*WAL).Replay"
+//	format=<text>    substring of format string, can be quoted
+//
+// Refer "log.debugrules" in Defaultsettings().
+func EnableDebug(rule string) error {
+	l, ok := getlog().(*defaultLogger)
+	if !ok {
+		return fmt.Errorf("dynamic debug not supported by %T", getlog())
+	}
+	r, err := parsedebugrule(rule)
+	if err != nil {
+		return err
+	}
+	l.updatedebug(func(dd *dyndebug) {
+		for _, rule := range dd.rules {
+			if rule.spec == r.spec {
+				return
+			}
+		}
+		dd.rules = append(dd.rules, r)
+	})
+	return nil
+}
+
+// DisableDebug remove a rule added using EnableDebug() or
+// "log.debugrules".
+func DisableDebug(rule string) error {
+	l, ok := getlog().(*defaultLogger)
+	if !ok {
+		return fmt.Errorf("dynamic debug not supported by %T", getlog())
+	}
+	r, err := parsedebugrule(rule)
+	if err != nil {
+		return err
+	}
+	found := false
+	l.updatedebug(func(dd *dyndebug) {
+		rules := []debugrule{}
+		for _, rule := range dd.rules {
+			if rule.spec == r.spec {
+				found = true
+				continue
+			}
+			rules = append(rules, rule)
+		}
+		dd.rules = rules
+	})
+	if !found {
+		return fmt.Errorf("debug rule %q not found", r.spec)
+	}
+	return nil
+}
+
+// DebugRules return dynamic debug rules of the default logger.
+func DebugRules() []string {
+	l, ok := getlog().(*defaultLogger)
+	if !ok || l.config().dyndebug == nil {
+		return []string{}
+	}
+	return l.config().dyndebug.specs()
+}
+
+// DebugSites return call sites hit while dynamic debug was active,
+// sorted by file and line, with their current state. Call sites are
+// forgotten when dynamic debug is deactivated or re-configured.
+func DebugSites() []DebugSite {
+	var dd *dyndebug
+	if l, ok := getlog().(*defaultLogger); ok {
+		dd = l.config().dyndebug
+	}
+	sites := []DebugSite{}
+	if dd == nil {
+		return sites
+	}
+	dd.sites.sites.Range(func(_, value interface{}) bool {
+		site := value.(*debugsite)
+		s := site.DebugSite
+		s.Enabled = dd.enabled(site)
+		s.Hits = atomic.LoadUint64(&site.hits)
+		sites = append(sites, s)
+		return true
+	})
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].File != sites[j].File {
+			return sites[i].File < sites[j].File
+		}
+		return sites[i].Line < sites[j].Line
+	})
+	return sites
+}
+
+// updatedebug apply fn on a copy of current dynamic debug config.
+func (l *defaultLogger) updatedebug(fn func(dd *dyndebug)) {
+	l.update(func(cfg *logconfig) {
+		dd := &dyndebug{}
+		if cfg.dyndebug != nil {
+			dd.track, dd.sites = cfg.dyndebug.track, cfg.dyndebug.sites
+			dd.rules = append(dd.rules, cfg.dyndebug.rules...)
+		}
+		fn(dd)
+		cfg.dyndebug = dd.normalize()
+	})
+}
+
+// dynenabled check whether call site, skip frames above the caller
+// of dynenabled, is enabled by a debug rule. Call sites are tracked
+// only while dynamic debug is active, else dynenabled is a load and a
+// compare.
+func (l *defaultLogger) dynenabled(skip int, level LogLevel, frmt string) bool {
+	dd := l.config().dyndebug
+	if dd == nil || level < LogLevelDebug || level > LogLevelTrace {
+		return false
+	}
+	var pcs [1]uintptr
+	runtime.Callers(skip+2, pcs[:])
+	value, ok := dd.sites.pcs.Load(pcs[0])
+	if !ok {
+		frame, _ := runtime.CallersFrames(pcs[:]).Next()
+		site := &debugsite{
+			DebugSite: DebugSite{
+				File: frame.File, Line: frame.Line, Func: frame.Function,
+				Format: frmt, Level: level,
+			},
+		}
+		key := frame.File + ":" + strconv.Itoa(frame.Line)
+		value, _ = dd.sites.sites.LoadOrStore(key, site)
+		dd.sites.pcs.Store(pcs[0], value)
+	}
+	site := value.(*debugsite)
+	atomic.AddUint64(&site.hits, 1)
+	return dd.enabled(site)
+}
+
+func (dd *dyndebug) enabled(site *debugsite) bool {
+	state := atomic.LoadUint64(&site.state)
+	if state>>1 != dd.gen {
+		state = dd.gen << 1
+		for _, rule := range dd.rules {
+			if rule.match(site) {
+				state |= 1
+				break
+			}
+		}
+		atomic.StoreUint64(&site.state, state)
+	}
+	return state&1 == 1
+}
+
+// normalize return nil if dd is inactive, else dd with a new
+// generation.
+func (dd *dyndebug) normalize() *dyndebug {
+	if !dd.track && len(dd.rules) == 0 {
+		return nil
+	} else if dd.sites == nil {
+		dd.sites = &debugsites{}
+	}
+	dd.gen = atomic.AddUint64(&debuggen, 1)
+	return dd
+}
+
+func (dd *dyndebug) specs() []string {
+	specs := make([]string, 0, len(dd.rules))
+	for _, rule := range dd.rules {
+		specs = append(specs, rule.spec)
+	}
+	return specs
+}
+
+// newdyndebug from "log.debugsites" and "log.debugrules" in setts.
+func newdyndebug(setts map[string]interface{}) (*dyndebug, error) {
+	dd := &dyndebug{}
+	var err error
+	if dd.track, err = settingbool(setts, "log.debugsites"); err != nil {
+		return nil, err
+	}
+	specs, err := settingrules(setts, "log.debugrules")
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range specs {
+		rule, err := parsedebugrule(spec)
+		if err != nil {
+			return nil, err
+		}
+		dd.rules = append(dd.rules, rule)
+	}
+	return dd.normalize(), nil
+}
+
+// settingrules return list of rules for key, string values are
+// separated by ";", since rules can contain ",".
+func settingrules(setts map[string]interface{}, key string) ([]string, error) {
+	s, ok := setts[key].(string)
+	if !ok {
+		return settingcsv(setts, key)
+	}
+	specs := []string{}
+	for _, spec := range strings.Split(s, ";") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+func parsedebugrule(spec string) (debugrule, error) {
+	rule := debugrule{}
+	terms, err := splitterms(spec)
+	if err != nil {
+		return rule, err
+	} else if len(terms) == 0 {
+		return rule, fmt.Errorf("empty debug rule")
+	}
+	normalized := []string{}
+	for _, term := range terms {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok || value == "" {
+			return rule, fmt.Errorf("invalid term %q in debug rule", term)
+		}
+		if value[0] == '"' {
+			if value, err = strconv.Unquote(value); err != nil {
+				return rule, fmt.Errorf("invalid term %q in debug rule", term)
+			}
+		}
+		switch key {
+		case "file":
+			rule.file = value
+		case "func":
+			rule.function = value
+		case "format":
+			rule.format = value
+		case "line":
+			if rule.minline, rule.maxline, err = parselines(value); err != nil {
+				return rule, err
+			}
+		default:
+			return rule, fmt.Errorf("unknown term %q in debug rule", key)
+		}
+		if strings.ContainsAny(value, " \t\"") {
+			value = strconv.Quote(value)
+		}
+		normalized = append(normalized, key+"="+value)
+	}
+	sort.Strings(normalized)
+	rule.spec = strings.Join(normalized, " ")
+	return rule, nil
+}
+
+func (rule debugrule) match(site *debugsite) bool {
+	if rule.file != "" && !matchfile(rule.file, site.File) {
+		return false
+	} else if rule.function != "" && !matchfunc(rule.function, site.Func) {
+		return false
+	} else if rule.format != "" && !strings.Contains(site.Format, rule.format) {
+		return false
+	} else if rule.maxline > 0 {
+		if site.Line < rule.minline || site.Line > rule.maxline {
+			return false
+		}
+	}
+	return true
+}
+
+// matchfile match pattern with as many trailing path components of
+// file, ".go" extension is optional in pattern.
+func matchfile(pattern, file string) bool {
+	if !strings.HasSuffix(pattern, ".go") {
+		file = strings.TrimSuffix(file, ".go")
+	}
+	return matchpath(pattern, file)
+}
+
+// matchfunc match pattern with function name, without package path,
+// like "storage.(*WAL).Replay", or with its last component, "Replay".
+func matchfunc(pattern, function string) bool {
+	if i := strings.LastIndexByte(function, '/'); i >= 0 {
+		function = function[i+1:]
+	}
+	name := function
+	if i := strings.LastIndexByte(function, '.'); i >= 0 {
+		name = function[i+1:]
+	}
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	pkgless := function
+	if i := strings.IndexByte(function, '.'); i >= 0 {
+		pkgless = function[i+1:]
+	}
+	if ok, _ := path.Match(pattern, pkgless); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, function)
+	return ok
+}
+
+func parselines(s string) (int, int, error) {
+	from, till, ok := strings.Cut(s, "-")
+	min, err := strconv.Atoi(from)
+	if err != nil || min <= 0 {
+		return 0, 0, fmt.Errorf("invalid line %q in debug rule", s)
+	}
+	max := min
+	if ok {
+		if max, err = strconv.Atoi(till); err != nil || max < min {
+			return 0, 0, fmt.Errorf("invalid line %q in debug rule", s)
+		}
+	}
+	return min, max, nil
+}
+
+// splitterms split spec on white space outside double quotes.
+func splitterms(spec string) ([]string, error) {
+	terms, quoted, start := []string{}, false, -1
+	for i := 0; i < len(spec); i++ {
+		c := spec[i]
+		switch {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == ' ' || c == '\t'):
+			if start >= 0 {
+				terms, start = append(terms, spec[start:i]), -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in debug rule %q", spec)
+	} else if start >= 0 {
+		terms = append(terms, spec[start:])
+	}
+	return terms, nil
+}
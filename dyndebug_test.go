@@ -0,0 +1,160 @@
+package log
+
+import "bytes"
+import "strconv"
+import "testing"
+
+func TestDynamicDebug(t *testing.T) {
+	var buf bytes.Buffer
+	setts := map[string]interface{}{
+		"log.level": "info", "log.timeformat": "", "log.debugsites": true,
+	}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	debugsite1 := func() { Debugf("replay segment %v", 1) }
+	debugsite2 := func() { Tracew("hit me", "n", 2) }
+	debugsite1()
+	debugsite2()
+	if buf.Len() != 0 {
+		t.Errorf("unexpected %q", buf.String())
+	}
+	snapshot := map[string]uint64{}
+	for _, site := range DebugSites() {
+		snapshot[site.Format] = site.Hits
+	}
+
+	rule := `format="hit me" file=dyndebug_test.go func=TestDynamicDebug*`
+	if err := EnableDebug(rule); err != nil {
+		t.Fatal(err)
+	}
+	debugsite1()
+	debugsite2()
+	if s, ref := buf.String(), "[Trace] hit me n=2\n"; s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+
+	sites := DebugSites()
+	found := 0
+	for _, site := range sites {
+		switch site.Format {
+		case "replay segment %v":
+			found++
+			hits := site.Hits - snapshot[site.Format]
+			if site.Enabled || hits != 1 || site.Level != LogLevelDebug {
+				t.Errorf("unexpected %+v", site)
+			}
+		case "hit me":
+			found++
+			hits := site.Hits - snapshot[site.Format]
+			if !site.Enabled || hits != 1 || site.Level != LogLevelTrace {
+				t.Errorf("unexpected %+v", site)
+			}
+		}
+	}
+	if found != 2 {
+		t.Errorf("unexpected %+v", sites)
+	}
+
+	// match by line number.
+	line := 0
+	for _, site := range sites {
+		if site.Format == "replay segment %v" {
+			line = site.Line
+		}
+	}
+	linerule := "file=dyndebug_test line=" + strconv.Itoa(line-1) + "-" +
+		strconv.Itoa(line)
+	if err := EnableDebug(linerule); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	debugsite1()
+	if s, ref := buf.String(), "[Debug] replay segment 1\n"; s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+
+	refs := []string{
+		`file=dyndebug_test.go format="hit me" func=TestDynamicDebug*`,
+		linerule,
+	}
+	if rules := DebugRules(); len(rules) != 2 || rules[0] != refs[0] {
+		t.Errorf("unexpected %q", rules)
+	} else if rules[1] != refs[1] {
+		t.Errorf("unexpected %q", rules)
+	}
+	if s := Settings()["log.debugrules"]; s != refs[0]+"; "+refs[1] {
+		t.Errorf("unexpected %v", s)
+	}
+
+	if err := DisableDebug(rule); err != nil {
+		t.Fatal(err)
+	} else if err := DisableDebug(rule); err == nil {
+		t.Errorf("expected error")
+	}
+	buf.Reset()
+	debugsite2()
+	if buf.Len() != 0 {
+		t.Errorf("unexpected %q", buf.String())
+	}
+
+	// call sites are forgotten when dynamic debug is re-configured.
+	setts = map[string]interface{}{"log.debugsites": true}
+	if err := Configure(setts); err != nil {
+		t.Fatal(err)
+	} else if sites := DebugSites(); len(sites) != 0 {
+		t.Errorf("unexpected %+v", sites)
+	}
+}
+
+func TestDebugRules(t *testing.T) {
+	setts := map[string]interface{}{
+		"log.debugrules": "file=a.go line=10-20; func=Replay format=\"a, b\"",
+	}
+	dd, err := newdyndebug(setts)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(dd.rules) != 2 {
+		t.Fatalf("unexpected %v", dd.specs())
+	}
+	site := &debugsite{
+		DebugSite: DebugSite{
+			File: "/src/x/a.go", Line: 15, Func: "x/y.(*WAL).Replay",
+			Format: "seen a, b",
+		},
+	}
+	testcases := []struct {
+		rule  debugrule
+		match bool
+	}{
+		{dd.rules[0], true},
+		{dd.rules[1], true},
+		{debugrule{file: "b"}, false},
+		{debugrule{file: "x/a"}, true},
+		{debugrule{minline: 16, maxline: 20}, false},
+		{debugrule{function: "(*WAL).*"}, true},
+		{debugrule{function: "y.(*WAL).Replay"}, true},
+		{debugrule{function: "Append"}, false},
+	}
+	for i, tc := range testcases {
+		if ok := tc.rule.match(site); ok != tc.match {
+			t.Errorf("%v expected %v, got %v", i, tc.match, ok)
+		}
+	}
+
+	bad := []string{
+		"", "file", "size=10", "line=0", "line=20-10", `format="x`,
+	}
+	for _, spec := range bad {
+		if _, err := parsedebugrule(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+	if err := validate(map[string]interface{}{"log.debugrules": "x=1"}); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -0,0 +1,227 @@
+package log
+
+import "fmt"
+import "time"
+import "strconv"
+import "runtime"
+import "unicode/utf8"
+import "encoding/json"
+import stdlog "log"
+
+// record is a single log entry handed over to encoders.
+type record struct {
+	when   time.Time
+	level  LogLevel
+	msg    string
+	name   string // logger name, refer Named().
+	caller string
+	pc     uintptr // call site, zero if not known.
+	fields []Field
+}
+
+// encodejson append record as a single line JSON object, with keys
+// "time", "level", "logger", "msg", "caller" followed by record's
+// fields.
+func encodejson(
+	out []byte, r *record, timeformat string, fullname bool) []byte {
+
+	if timeformat == "" {
+		timeformat = time.RFC3339Nano
+	}
+	out = append(out, `{"time":`...)
+	out = appendjsonstr(out, r.when.Format(timeformat))
+	out = append(out, `,"level":`...)
+	out = appendjsonstr(out, r.level.name(fullname))
+	if r.name != "" {
+		out = append(out, `,"logger":`...)
+		out = appendjsonstr(out, r.name)
+	}
+	out = append(out, `,"msg":`...)
+	out = appendjsonstr(out, r.msg)
+	if r.caller != "" {
+		out = append(out, `,"caller":`...)
+		out = appendjsonstr(out, r.caller)
+	}
+	for _, field := range r.fields {
+		out = append(out, ',')
+		out = appendjsonstr(out, field.Key)
+		out = append(out, ':')
+		out = appendjsonval(out, field.Value)
+	}
+	return append(out, '}')
+}
+
+// encodelogfmt append record as a line of key=value pairs, starting
+// with "ts", "level", "logger", "msg", "caller" followed by record's
+// fields.
+func encodelogfmt(
+	out []byte, r *record, timeformat string, fullname bool) []byte {
+
+	if timeformat == "" {
+		timeformat = time.RFC3339Nano
+	}
+	out = append(out, "ts="...)
+	out = appendvalue(out, r.when.Format(timeformat))
+	out = append(out, " level="...)
+	out = appendvalue(out, r.level.name(fullname))
+	if r.name != "" {
+		out = append(out, " logger="...)
+		out = appendvalue(out, r.name)
+	}
+	out = append(out, " msg="...)
+	out = appendvalue(out, r.msg)
+	if r.caller != "" {
+		out = append(out, " caller="...)
+		out = appendvalue(out, r.caller)
+	}
+	return appendfields(out, r.fields)
+}
+
+// appendjsonval marshal value as JSON, errors are encoded as their
+// Error() string and values that cannot be marshaled are encoded as
+// their %v string. Error() and String() are called via fmt, which
+// prints "<nil>" for nil pointer receivers and recovers panics.
+func appendjsonval(out []byte, value interface{}) []byte {
+	switch val := value.(type) {
+	case string:
+		return appendjsonstr(out, val)
+	case error, fmt.Stringer:
+		return appendjsonstr(out, fmt.Sprintf("%v", val))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return appendjsonstr(out, fmt.Sprintf("%v", value))
+	}
+	return append(out, data...)
+}
+
+// appendjsonstr quote s as JSON string, invalid utf8 sequences are
+// replaced with utf8.RuneError.
+func appendjsonstr(out []byte, s string) []byte {
+	out = append(out, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				out = append(out, '\\', c)
+			case c == '\n':
+				out = append(out, '\\', 'n')
+			case c == '\r':
+				out = append(out, '\\', 'r')
+			case c == '\t':
+				out = append(out, '\\', 't')
+			case c < 0x20:
+				out = append(out, `\u00`...)
+				out = append(out, hexdigits[c>>4], hexdigits[c&0xf])
+			default:
+				out = append(out, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			out = append(out, `�`...)
+		} else {
+			out = append(out, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(out, '"')
+}
+
+const hexdigits = "0123456789abcdef"
+
+// shortcaller return "dir/file.go:line" for file and line.
+func shortcaller(file string, line int) string {
+	if file == "" {
+		return ""
+	}
+	short, seps := file, 0
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			if seps++; seps == 2 {
+				short = file[i+1:]
+				break
+			}
+		}
+	}
+	return short + ":" + strconv.Itoa(line)
+}
+
+// callerinfo return file and line for program counter pc, as
+// returned by runtime.Callers().
+func callerinfo(pc uintptr) (string, int) {
+	if pc == 0 {
+		return "", 0
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return frame.File, frame.Line
+}
+
+// appendheader same as golang's standard logger, for log.flags.
+func appendheader(
+	out []byte, t time.Time, file string, line, flags int) []byte {
+
+	if flags&(stdlog.Ldate|stdlog.Ltime|stdlog.Lmicroseconds) != 0 {
+		if flags&stdlog.LUTC != 0 {
+			t = t.UTC()
+		}
+		if flags&stdlog.Ldate != 0 {
+			year, month, day := t.Date()
+			out = appendint(out, year, 4)
+			out = append(out, '/')
+			out = appendint(out, int(month), 2)
+			out = append(out, '/')
+			out = appendint(out, day, 2)
+			out = append(out, ' ')
+		}
+		if flags&(stdlog.Ltime|stdlog.Lmicroseconds) != 0 {
+			hour, min, sec := t.Clock()
+			out = appendint(out, hour, 2)
+			out = append(out, ':')
+			out = appendint(out, min, 2)
+			out = append(out, ':')
+			out = appendint(out, sec, 2)
+			if flags&stdlog.Lmicroseconds != 0 {
+				out = append(out, '.')
+				out = appendint(out, t.Nanosecond()/1e3, 6)
+			}
+			out = append(out, ' ')
+		}
+	}
+	if flags&(stdlog.Lshortfile|stdlog.Llongfile) != 0 {
+		if file == "" {
+			file, line = "???", 0
+		}
+		if flags&stdlog.Lshortfile != 0 {
+			for i := len(file) - 1; i > 0; i-- {
+				if file[i] == '/' {
+					file = file[i+1:]
+					break
+				}
+			}
+		}
+		out = append(out, file...)
+		out = append(out, ':')
+		out = strconv.AppendInt(out, int64(line), 10)
+		out = append(out, ": "...)
+	}
+	return out
+}
+
+// appendint with zero padding upto width.
+func appendint(out []byte, i int, width int) []byte {
+	var b [20]byte
+	n := len(b) - 1
+	for i >= 10 || width > 1 {
+		width--
+		q := i / 10
+		b[n] = byte('0' + i - q*10)
+		n--
+		i = q
+	}
+	b[n] = byte('0' + i)
+	return append(out, b[n:]...)
+}
@@ -0,0 +1,132 @@
+package log
+
+import "bytes"
+import "errors"
+import "strings"
+import "testing"
+import "time"
+import "encoding/json"
+
+func TestJSONFormat(t *testing.T) {
+	setts := map[string]interface{}{
+		"log.level": "info", "log.format": "json", "log.flags": "lshortfile",
+		"log.colorinfo": "red",
+	}
+	var buf bytes.Buffer
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := "line1\nline2 \"quoted\"\t\x01"
+	logger.With("reqid", 10).Infow(msg, "err", errors.New("eof"), "n", 1.5)
+	s := buf.String()
+	if strings.Count(s, "\n") != 1 {
+		t.Fatalf("expected single line, got %q", s)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("%v: %q", err, s)
+	}
+	if m["msg"] != msg {
+		t.Errorf("expected %q, got %q", msg, m["msg"])
+	} else if m["level"] != "Infom" {
+		t.Errorf("unexpected level %v", m["level"])
+	} else if m["reqid"] != float64(10) || m["n"] != 1.5 || m["err"] != "eof" {
+		t.Errorf("unexpected fields %v", m)
+	} else if !strings.Contains(m["caller"].(string), "/encoder_test.go:") {
+		t.Errorf("unexpected caller %v", m["caller"])
+	}
+	if when, ok := m["time"].(string); !ok {
+		t.Errorf("missing time in %v", m)
+	} else if _, err := time.Parse(time.RFC3339Nano, when); err != nil {
+		t.Errorf("unexpected time %q: %v", when, err)
+	}
+}
+
+func TestAppendjsonstr(t *testing.T) {
+	testcases := []string{"", "hello", "a\"b\\c", "  \x00 \x1f", "€"}
+	for _, tc := range testcases {
+		var s string
+		if err := json.Unmarshal(appendjsonstr(nil, tc), &s); err != nil {
+			t.Error(err)
+		} else if s != tc {
+			t.Errorf("expected %q, got %q", tc, s)
+		}
+	}
+	if s := string(appendjsonstr(nil, "a\xffb")); s != `"a�b"` {
+		t.Errorf("unexpected %q", s)
+	}
+}
+
+type valstringer struct{ s string }
+
+func (v valstringer) String() string { return v.s }
+
+type valerror struct{ s string }
+
+func (v valerror) Error() string { return v.s }
+
+func TestAppendjsonvalNil(t *testing.T) {
+	testcases := []interface{}{(*valstringer)(nil), (*valerror)(nil)}
+	for _, tc := range testcases {
+		if s := string(appendjsonval(nil, tc)); s != `"<nil>"` {
+			t.Errorf("%T expected %q, got %q", tc, `"<nil>"`, s)
+		}
+	}
+	if s := string(appendjsonval(nil, &valstringer{"x"})); s != `"x"` {
+		t.Errorf("unexpected %q", s)
+	}
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	setts := map[string]interface{}{
+		"log.level": "info", "log.format": "logfmt", "log.levelname": "full",
+		"log.timeformat": "2006",
+	}
+	var buf bytes.Buffer
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Warnw("disk full", "path", "/var/a b", "q", `say "hi"`,
+		"eq", "a=b", "bad key", "", "n", 10)
+	s := buf.String()
+	if !strings.HasPrefix(s, "ts=2") || !strings.Contains(s, " level=warn ") {
+		t.Errorf("unexpected %q", s)
+	} else if !strings.Contains(s, ` msg="disk full" caller=`) {
+		t.Errorf("unexpected %q", s)
+	}
+	ref := ` path="/var/a b" q="say \"hi\"" eq="a=b" bad_key="" n=10` + "\n"
+	if !strings.HasSuffix(s, ref) {
+		t.Errorf("expected suffix %q, got %q", ref, s)
+	}
+}
+
+func TestLevelName(t *testing.T) {
+	setts := map[string]interface{}{
+		"log.level": "info", "log.flags": "", "log.timeformat": "",
+		"log.levelname": "full",
+	}
+	var buf bytes.Buffer
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Infof("hello")
+	if s := buf.String(); s != "[info] hello\n" {
+		t.Errorf("unexpected %q", s)
+	}
+	names := []string{
+		"ignore", "fatal", "error", "warn", "info", "verbose", "debug", "trace",
+	}
+	for _, name := range names {
+		if level, err := ParseLevel(name); err != nil {
+			t.Error(err)
+		} else if s := level.Name(); s != name {
+			t.Errorf("expected %v, got %v", name, s)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package log
+
+import "fmt"
+import "errors"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+// Field is a key/value pair attached to a log record, either by
+// creating a child logger using With() or by using one of the field
+// aware variants like Infow().
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// With returns a child of the default logger carrying keyvals on every
+// log record. Refer to Logger.With() for details.
+func With(keyvals ...interface{}) Logger {
+	return getlog().With(keyvals...)
+}
+
+// With for defaultLogger.
+func (l *defaultLogger) With(keyvals ...interface{}) Logger {
+	child := *l
+	fields := make([]Field, 0, len(l.fields)+(len(keyvals)+1)/2)
+	fields = append(fields, l.fields...)
+	child.fields = kv2fields(fields, keyvals)
+	return &child
+}
+
+// Fatalw for defaultLogger
+func (l *defaultLogger) Fatalw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelFatal, msg, keyvals...)
+}
+
+// Errorw for defaultLogger
+func (l *defaultLogger) Errorw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelError, msg, keyvals...)
+}
+
+// Warnw for defaultLogger
+func (l *defaultLogger) Warnw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelWarn, msg, keyvals...)
+}
+
+// Infow for defaultLogger
+func (l *defaultLogger) Infow(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelInfo, msg, keyvals...)
+}
+
+// Verbosew for defaultLogger
+func (l *defaultLogger) Verbosew(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelVerbose, msg, keyvals...)
+}
+
+// Debugw for defaultLogger
+func (l *defaultLogger) Debugw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelDebug, msg, keyvals...)
+}
+
+// Tracew for defaultLogger
+func (l *defaultLogger) Tracew(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelTrace, msg, keyvals...)
+}
+
+// Printlw for defaultLogger
+func (l *defaultLogger) Printlw(level LogLevel, msg string, keyvals ...interface{}) {
+	if l.dynenabled(2, level, msg) || l.Enabled(level) {
+		l.output(level, trimformat(msg), kv2fields(nil, keyvals))
+	}
+}
+
+// Fatalw similar to Fatalf, logs msg followed by key/value fields.
+func Fatalw(msg string, keyvals ...interface{}) {
+	getlog().Printlw(LogLevelFatal, msg, keyvals...)
+	getlog().Sync()
+	panic(errors.New(msg))
+}
+
+// Errorw similar to Errorf, logs msg followed by key/value fields.
+func Errorw(msg string, keyvals ...interface{}) {
+	getlog().Printlw(LogLevelError, msg, keyvals...)
+}
+
+// Warnw similar to Warnf, logs msg followed by key/value fields.
+func Warnw(msg string, keyvals ...interface{}) {
+	getlog().Printlw(LogLevelWarn, msg, keyvals...)
+}
+
+// Infow similar to Infof, logs msg followed by key/value fields.
+func Infow(msg string, keyvals ...interface{}) {
+	getlog().Printlw(LogLevelInfo, msg, keyvals...)
+}
+
+// Verbosew similar to Verbosef, logs msg followed by key/value fields.
+func Verbosew(msg string, keyvals ...interface{}) {
+	getlog().Printlw(LogLevelVerbose, msg, keyvals...)
+}
+
+// Debugw similar to Debugf, logs msg followed by key/value fields.
+func Debugw(msg string, keyvals ...interface{}) {
+	getlog().Printlw(LogLevelDebug, msg, keyvals...)
+}
+
+// Tracew similar to Tracef, logs msg followed by key/value fields.
+func Tracew(msg string, keyvals ...interface{}) {
+	getlog().Printlw(LogLevelTrace, msg, keyvals...)
+}
+
+// kv2fields append alternating key/value arguments as fields. Keys
+// that are not string are formatted using %v, and a dangling key is
+// paired with "(MISSING)".
+func kv2fields(fields []Field, keyvals []interface{}) []Field {
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", keyvals[i])
+		}
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fields = append(fields, Field{Key: key, Value: value})
+	}
+	return fields
+}
+
+// joinfields avoid allocation when either of the list is empty.
+func joinfields(fields, more []Field) []Field {
+	if len(more) == 0 {
+		return fields
+	} else if len(fields) == 0 {
+		return more
+	}
+	out := make([]Field, 0, len(fields)+len(more))
+	return append(append(out, fields...), more...)
+}
+
+// appendfields to text output as space separated key=value pairs.
+func appendfields(out []byte, fields []Field) []byte {
+	for _, field := range fields {
+		out = append(out, ' ')
+		out = appendkey(out, field.Key)
+		out = append(out, '=')
+		out = appendvalue(out, fmt.Sprintf("%v", field.Value))
+	}
+	return out
+}
+
+// appendkey replaces characters that cannot be part of a key with '_'.
+func appendkey(out []byte, key string) []byte {
+	if key == "" {
+		return append(out, '_')
+	}
+	for _, r := range key {
+		if needsquote(r) {
+			r = '_'
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return out
+}
+
+// appendvalue quotes value if it is empty or contains space, '=',
+// quotes or control characters.
+func appendvalue(out []byte, value string) []byte {
+	if value == "" || strings.IndexFunc(value, needsquote) >= 0 {
+		return strconv.AppendQuote(out, value)
+	}
+	return append(out, value...)
+}
+
+func needsquote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+}
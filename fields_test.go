@@ -0,0 +1,66 @@
+package log
+
+import "bytes"
+import "testing"
+import "strings"
+
+func TestWithFields(t *testing.T) {
+	setts := map[string]interface{}{
+		"log.level": "info", "log.flags": "", "log.timeformat": "",
+	}
+	var buf bytes.Buffer
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	child := With("reqid", 10, "peer", "10.0.0.1:80")
+	child.With("tenant", "a b").Infof("hello %v", "world")
+	ref := `[Infom] hello world reqid=10 peer=10.0.0.1:80 tenant="a b"` + "\n"
+	if s := buf.String(); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+
+	buf.Reset()
+	child.Infow("connected", "retry", 2, "dangling")
+	ref = "[Infom] connected reqid=10 peer=10.0.0.1:80 retry=2 " +
+		"dangling=(MISSING)\n"
+	if s := buf.String(); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+
+	buf.Reset()
+	child.Debugw("filtered", "key", "value")
+	if s := buf.String(); s != "" {
+		t.Errorf("unexpected %q", s)
+	}
+
+	// parent should not inherit fields from child.
+	buf.Reset()
+	Infow("parent", 1, "x=y")
+	ref = `[Infom] parent 1="x=y"` + "\n"
+	if s := buf.String(); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+}
+
+func TestKv2fields(t *testing.T) {
+	fields := kv2fields(nil, []interface{}{"a", 1, 2, "b", "c"})
+	if len(fields) != 3 {
+		t.Fatalf("unexpected %v", fields)
+	} else if fields[1].Key != "2" || fields[1].Value != "b" {
+		t.Errorf("unexpected %v", fields[1])
+	} else if fields[2].Key != "c" || fields[2].Value != "(MISSING)" {
+		t.Errorf("unexpected %v", fields[2])
+	}
+
+	out := string(appendfields(nil, []Field{{"k", ""}, {"q", `a"b`}}))
+	if ref := ` k="" q="a\"b"`; out != ref {
+		t.Errorf("expected %q, got %q", ref, out)
+	}
+	if strings.Contains(string(appendfields(nil, nil)), " ") {
+		t.Errorf("unexpected output for empty fields")
+	}
+}
@@ -0,0 +1,138 @@
+package log
+
+import "fmt"
+import "sync"
+import "time"
+import "strings"
+import "net/http"
+import "encoding/json"
+
+// levelttl restore the default logger's level once a temporary level,
+// set via Handler(), expires.
+var levelttl struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	logger Logger // logger whose level was changed.
+	level  string // level to restore.
+}
+
+// Handler return an http.Handler to view and change the default
+// logger's configuration, meant to be mounted on an admin port.
+//
+// GET returns effective settings as JSON object, refer Settings().
+//
+// PUT or POST changes the log level, parameters are read either from
+// JSON body, like {"level": "debug", "ttl": "10m"}, or from url-query
+// and form values, like ?level=debug&ttl=10m. If ttl is given, the
+// previous level is restored once ttl expires. Setting a level
+// without ttl cancels pending restore. Responds with effective
+// settings after the change.
+func Handler() http.Handler {
+	return http.HandlerFunc(handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writesettings(w)
+
+	case http.MethodPut, http.MethodPost:
+		level, ttl, err := levelparams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		setlevelttl(level, ttl)
+		writesettings(w)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writesettings(w http.ResponseWriter) {
+	data, err := json.Marshal(Settings())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// levelparams return validated level and ttl from request.
+func levelparams(r *http.Request) (string, time.Duration, error) {
+	var params struct {
+		Level string `json:"level"`
+		TTL   string `json:"ttl"`
+	}
+	ctype := r.Header.Get("Content-Type")
+	if strings.HasPrefix(ctype, "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			return "", 0, fmt.Errorf("invalid request: %v", err)
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return "", 0, fmt.Errorf("invalid request: %v", err)
+	} else {
+		params.Level, params.TTL = r.FormValue("level"), r.FormValue("ttl")
+	}
+
+	if params.Level == "" {
+		return "", 0, fmt.Errorf("missing level")
+	}
+	level, err := ParseLevel(params.Level)
+	if err != nil {
+		return "", 0, err
+	}
+	ttl := time.Duration(0)
+	if params.TTL != "" {
+		if ttl, err = time.ParseDuration(params.TTL); err != nil {
+			return "", 0, fmt.Errorf("invalid ttl: %v", err)
+		} else if ttl <= 0 {
+			return "", 0, fmt.Errorf("invalid ttl %q", params.TTL)
+		}
+	}
+	return level.Name(), ttl, nil
+}
+
+// setlevelttl set level on the default logger, and if ttl is non-zero,
+// restore the current level after ttl. If a restore is already pending
+// its level is retained, so that stacked temporary changes fall back
+// to the original level.
+func setlevelttl(level string, ttl time.Duration) {
+	levelttl.mu.Lock()
+	defer levelttl.mu.Unlock()
+
+	logger := getlog()
+	prevlevel := Settings()["log.level"].(string)
+	if levelttl.timer != nil {
+		levelttl.timer.Stop()
+		levelttl.timer = nil
+		if levelttl.logger == logger {
+			prevlevel = levelttl.level
+		}
+	}
+	logger.SetLogLevel(level)
+	if ttl == 0 {
+		Infof("log: level set to %v\n", level)
+		return
+	}
+
+	levelttl.logger, levelttl.level = logger, prevlevel
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		levelttl.mu.Lock()
+		defer levelttl.mu.Unlock()
+		if levelttl.timer != timer { // cancelled or superseded.
+			return
+		}
+		levelttl.timer = nil
+		if getlog() == logger { // logger not replaced meanwhile.
+			logger.SetLogLevel(prevlevel)
+			Infof("log: level restored to %v\n", prevlevel)
+		}
+	})
+	levelttl.timer = timer
+	Infof("log: level set to %v for %v\n", level, ttl)
+}
@@ -0,0 +1,98 @@
+package log
+
+import "bytes"
+import "strings"
+import "testing"
+import "net/http"
+import "encoding/json"
+import "net/http/httptest"
+
+func TestHandlerGet(t *testing.T) {
+	setts := map[string]interface{}{
+		"log.level": "warn", "log.flags": "ldate,lshortfile",
+		"log.colorerror": "bold,red",
+	}
+	logger, err := New(&bytes.Buffer{}, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/log", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected %v", rec.Code)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	refs := map[string]interface{}{
+		"log.level": "warn", "log.flags": "ldate,lshortfile",
+		"log.colorerror": "bold,red", "log.colorinfo": "", "log.file": "",
+	}
+	for key, ref := range refs {
+		if got[key] != ref {
+			t.Errorf("%v expected %v, got %v", key, ref, got[key])
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("DELETE", "/log", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected %v", rec.Code)
+	}
+}
+
+func TestHandlerLevel(t *testing.T) {
+	logger, err := New(&bytes.Buffer{}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	put := func(body, ctype string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/log", strings.NewReader(body))
+		req.Header.Set("Content-Type", ctype)
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	form := "application/x-www-form-urlencoded"
+
+	if rec := put(`{"level": "loud"}`, "application/json"); rec.Code != 400 {
+		t.Errorf("unexpected %v", rec.Code)
+	} else if rec := put("level=debug&ttl=-1s", form); rec.Code != 400 {
+		t.Errorf("unexpected %v", rec.Code)
+	}
+
+	// stacked temporary levels restore the original level.
+	if rec := put(`{"level": "debug", "ttl": "1h"}`, "application/json"); rec.Code != 200 {
+		t.Fatalf("unexpected %v %s", rec.Code, rec.Body)
+	} else if !Enabled(LogLevelDebug) {
+		t.Errorf("expected debug level")
+	}
+	if rec := put("level=trace&ttl=20ms", form); rec.Code != 200 {
+		t.Fatalf("unexpected %v %s", rec.Code, rec.Body)
+	} else if !strings.Contains(rec.Body.String(), `"log.level":"trace"`) {
+		t.Errorf("unexpected %s", rec.Body)
+	}
+	waitfor(t, func() bool { return !Enabled(LogLevelVerbose) })
+	if !Enabled(LogLevelInfo) {
+		t.Errorf("expected info level")
+	}
+
+	// level without ttl cancels pending restore.
+	put("level=trace&ttl=10ms", form)
+	put("level=error", form)
+	levelttl.mu.Lock()
+	pending := levelttl.timer != nil
+	levelttl.mu.Unlock()
+	if pending {
+		t.Errorf("expected pending restore to be cancelled")
+	} else if Enabled(LogLevelWarn) || !Enabled(LogLevelError) {
+		t.Errorf("expected error level")
+	}
+}
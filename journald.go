@@ -0,0 +1,170 @@
+package log
+
+import "os"
+import "bytes"
+import "fmt"
+import "net"
+import "sync"
+import "strconv"
+import "runtime"
+import "path/filepath"
+import "encoding/binary"
+
+// journalsocket of systemd-journald's native protocol.
+const journalsocket = "/run/systemd/journal/socket"
+
+// journaldWriter send records to systemd-journald using its native
+// protocol, one datagram per record. Records are encoded by
+// encoderecord() with PRIORITY, CODE_FILE, CODE_LINE, CODE_FUNC,
+// SYSLOG_IDENTIFIER, LOGGER and record fields in upper case. Entries
+// too large for a datagram are passed as a sealed memfd.
+type journaldWriter struct {
+	address string
+	appname string
+
+	mu   sync.Mutex
+	addr *net.UnixAddr
+	conn *net.UnixConn // unconnected, every datagram is sent to addr.
+}
+
+// newJournaldWriter reading "log.sinks.<name>.address" and "appname"
+// from validated setts.
+func newJournaldWriter(
+	name string, setts map[string]interface{}) (*journaldWriter, error) {
+
+	key := "log.sinks." + name + "."
+	w := &journaldWriter{}
+	if w.address, _ = settingstring(setts, key+"address"); w.address == "" {
+		w.address = journalsocket
+	}
+	w.addr = &net.UnixAddr{Name: w.address, Net: "unixgram"}
+	if w.appname, _ = settingstring(setts, key+"appname"); w.appname == "" {
+		w.appname = filepath.Base(os.Args[0])
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect open an unbound datagram socket, if journald's socket
+// exists. Shall be called with mu locked, or before w is shared.
+func (w *journaldWriter) connect() (err error) {
+	if _, err = os.Stat(w.address); err != nil {
+		return err
+	}
+	w.conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	return err
+}
+
+// Write implement io.Writer, p is sent as a single journal entry,
+// reconnecting once if the write fails.
+func (w *journaldWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				return 0, err
+			}
+		}
+		if _, _, err = w.conn.WriteMsgUnix(p, nil, w.addr); toolarge(err) {
+			err = sendlarge(w.conn, w.addr, p)
+		}
+		if err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+// Close the socket to journald.
+func (w *journaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// encoderecord as journal entry in native protocol.
+func (w *journaldWriter) encoderecord(r *record) []byte {
+	out := make([]byte, 0, 256)
+	out = appendjournal(out, "MESSAGE", r.msg)
+	out = appendjournal(out, "PRIORITY", strconv.Itoa(SyslogSeverity(r.level)))
+	out = appendjournal(out, "SYSLOG_IDENTIFIER", w.appname)
+	if r.name != "" {
+		out = appendjournal(out, "LOGGER", r.name)
+	}
+	if r.pc != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.pc}).Next()
+		out = appendjournal(out, "CODE_FILE", frame.File)
+		out = appendjournal(out, "CODE_LINE", strconv.Itoa(frame.Line))
+		out = appendjournal(out, "CODE_FUNC", frame.Function)
+	}
+	for _, field := range r.fields {
+		key := journalkey(field.Key)
+		out = appendjournal(out, key, fmt.Sprintf("%v", field.Value))
+	}
+	return out
+}
+
+// settings add journald parameters of sink key to setts.
+func (w *journaldWriter) settings(setts map[string]interface{}, key string) {
+	setts[key+"address"], setts[key+"appname"] = w.address, w.appname
+}
+
+// appendjournal append KEY=value, values with newline are appended
+// as KEY, newline, 64-bit little endian length and value.
+func appendjournal(out []byte, key, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\n' {
+			out = append(append(out, key...), '\n')
+			out = binary.LittleEndian.AppendUint64(out, uint64(len(value)))
+			return append(append(out, value...), '\n')
+		}
+	}
+	out = append(append(out, key...), '=')
+	return append(append(out, value...), '\n')
+}
+
+// journalkey return key as a journal field name, upper case letters,
+// digits and '_', not starting with '_' or a digit, upto 64
+// characters. Keys colliding with fields set by encoderecord() are
+// prefixed with "F_".
+func journalkey(key string) string {
+	out := make([]byte, 0, len(key))
+	for i := 0; i < len(key) && len(out) < 64; i++ {
+		switch c := key[i]; {
+		case c >= 'a' && c <= 'z':
+			out = append(out, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			out = append(out, c)
+		case len(out) > 0:
+			out = append(out, '_')
+		}
+	}
+	digit := len(out) > 0 && out[0] >= '0' && out[0] <= '9'
+	if len(out) == 0 || digit || journalreserved(out) {
+		out = append([]byte("F_"), out...)
+		if len(out) > 64 {
+			out = out[:64]
+		}
+	}
+	return string(out)
+}
+
+func journalreserved(key []byte) bool {
+	switch string(key) {
+	case "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER", "LOGGER":
+		return true
+	}
+	return bytes.HasPrefix(key, []byte("CODE_"))
+}
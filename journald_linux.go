@@ -0,0 +1,76 @@
+//go:build linux
+
+package log
+
+import "os"
+import "net"
+import "errors"
+import "runtime"
+import "syscall"
+import "unsafe"
+
+// sysmemfdcreate by GOARCH, syscall package does not define
+// SYS_MEMFD_CREATE for every architecture.
+var sysmemfdcreate = map[string]uintptr{
+	"386": 356, "amd64": 319, "arm": 385, "arm64": 279, "loong64": 279,
+	"mips64": 5314, "mips64le": 5314, "ppc64": 360, "ppc64le": 360,
+	"riscv64": 279, "s390x": 350,
+}
+
+const (
+	mfdcloexec       = 0x1
+	mfdallowsealing  = 0x2
+	faddseals        = 1033
+	fsealall         = 0x1 | 0x2 | 0x4 | 0x8 // seal, shrink, grow, write
+	journalshmprefix = "/dev/shm"
+)
+
+// toolarge return whether err is due to datagram size.
+func toolarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendlarge pass entry p to journald as a sealed memfd. If memfd is
+// not available an unlinked file in /dev/shm is passed instead.
+func sendlarge(conn *net.UnixConn, addr *net.UnixAddr, p []byte) error {
+	fd, err := memfd(p)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	rights := syscall.UnixRights(int(fd.Fd()))
+	_, _, err = conn.WriteMsgUnix(nil, rights, addr)
+	return err
+}
+
+func memfd(p []byte) (*os.File, error) {
+	name := []byte("journal-golog\x00")
+	if trap, ok := sysmemfdcreate[runtime.GOARCH]; ok {
+		r, _, errno := syscall.Syscall(
+			trap, uintptr(unsafe.Pointer(&name[0])), mfdcloexec|mfdallowsealing, 0)
+		if errno == 0 {
+			fd := os.NewFile(r, "journal-golog")
+			if _, err := fd.Write(p); err != nil {
+				fd.Close()
+				return nil, err
+			}
+			_, _, errno = syscall.Syscall(
+				syscall.SYS_FCNTL, fd.Fd(), faddseals, fsealall)
+			if errno != 0 {
+				fd.Close()
+				return nil, errno
+			}
+			return fd, nil
+		}
+	}
+	fd, err := os.CreateTemp(journalshmprefix, "journal-golog-")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(fd.Name())
+	if _, err := fd.Write(p); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return fd, nil
+}
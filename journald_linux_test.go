@@ -0,0 +1,60 @@
+//go:build linux
+
+package log
+
+import "os"
+import "strings"
+import "testing"
+import "syscall"
+
+func TestJournaldLarge(t *testing.T) {
+	conn, path := journalstandin(t)
+	setts := map[string]interface{}{
+		"log.sinks":                 "journal",
+		"log.sinks.journal.writer":  "journald",
+		"log.sinks.journal.address": path,
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	msg := strings.Repeat("x", 4<<20) // larger than a datagram.
+	logger.Infof("%s", msg)
+
+	buf, oob := make([]byte, 16), make([]byte, 64)
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected empty datagram, got %v bytes", n)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("unexpected %v %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("unexpected %v %v", fds, err)
+	}
+	fd := os.NewFile(uintptr(fds[0]), "entry")
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, info.Size())
+	if _, err := fd.ReadAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	entry := parsejournal(t, data)
+	if values := entry["MESSAGE"]; len(values) != 1 || values[0] != msg {
+		t.Errorf("unexpected message of %v values", len(values))
+	}
+	// memfd is sealed against writes.
+	if _, err := fd.WriteAt([]byte("y"), 0); err == nil {
+		t.Errorf("expected sealed memfd")
+	}
+}
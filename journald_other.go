@@ -0,0 +1,14 @@
+//go:build !linux
+
+package log
+
+import "net"
+import "errors"
+
+func toolarge(err error) bool {
+	return false
+}
+
+func sendlarge(conn *net.UnixConn, addr *net.UnixAddr, p []byte) error {
+	return errors.New("journald not supported")
+}
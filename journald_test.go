@@ -0,0 +1,119 @@
+package log
+
+import "os"
+import "net"
+import "bytes"
+import "strings"
+import "testing"
+import "path/filepath"
+import "encoding/binary"
+
+// journalstandin listen on a unixgram socket in place of journald.
+func journalstandin(t *testing.T) (*net.UnixConn, string) {
+	dir, err := os.MkdirTemp("", "golog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+// parsejournal decode native protocol entry into key -> values.
+func parsejournal(t *testing.T, data []byte) map[string][]string {
+	entry := map[string][]string{}
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatalf("invalid entry %q", data)
+		}
+		key := string(data[:i])
+		if data[i] == '=' {
+			j := bytes.IndexByte(data, '\n')
+			entry[key] = append(entry[key], string(data[i+1:j]))
+			data = data[j+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(data[i+1 : i+9])
+		value := data[i+9 : i+9+int(size)]
+		entry[key] = append(entry[key], string(value))
+		data = data[i+9+int(size)+1:]
+	}
+	return entry
+}
+
+func TestJournald(t *testing.T) {
+	conn, path := journalstandin(t)
+	setts := map[string]interface{}{
+		"log.sinks":                  "journal",
+		"log.sinks.journal.writer":   "journald",
+		"log.sinks.journal.address":  path,
+		"log.sinks.journal.appname":  "myapp",
+		"log.sinks.journal.minlevel": "warn",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Infof("hidden")
+	logger.(*defaultLogger).Named("storage").With("req-id", 7).
+		Warnw("slow\nwrite", "_path", "/a", "2fa", true, "priority", 0)
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := parsejournal(t, buf[:n])
+	refs := map[string]string{
+		"MESSAGE": "slow\nwrite", "PRIORITY": "4", "SYSLOG_IDENTIFIER": "myapp",
+		"LOGGER": "storage", "CODE_FUNC": "github.com/bnclabs/golog.TestJournald",
+		"REQ_ID": "7", "PATH": "/a", "F_2FA": "true", "F_PRIORITY": "0",
+	}
+	for key, ref := range refs {
+		if values := entry[key]; len(values) != 1 || values[0] != ref {
+			t.Errorf("%v expected %q, got %q", key, ref, values)
+		}
+	}
+	if file := entry["CODE_FILE"]; len(file) != 1 || !strings.HasSuffix(file[0], "journald_test.go") {
+		t.Errorf("unexpected %q", file)
+	} else if line := entry["CODE_LINE"]; len(line) != 1 || line[0] == "0" {
+		t.Errorf("unexpected %q", line)
+	}
+
+	setts = logger.(*defaultLogger).Settings()
+	if s := setts["log.sinks.journal.address"]; s != path {
+		t.Errorf("unexpected %v", s)
+	} else if s := setts["log.sinks.journal.writer"]; s != "journald" {
+		t.Errorf("unexpected %v", s)
+	}
+}
+
+func TestJournalKey(t *testing.T) {
+	testcases := [][2]string{
+		{"reqid", "REQID"}, {"req.id", "REQ_ID"}, {"_trusted", "TRUSTED"},
+		{"9lives", "F_9LIVES"}, {"", "F_"}, {"..", "F_"},
+		{"priority", "F_PRIORITY"}, {"message", "F_MESSAGE"},
+		{"code.line", "F_CODE_LINE"}, {"logger", "F_LOGGER"},
+		{"syslog_identifier", "F_SYSLOG_IDENTIFIER"}, {"messages", "MESSAGES"},
+		{strings.Repeat("a", 70), strings.Repeat("A", 64)},
+	}
+	for _, tc := range testcases {
+		if key := journalkey(tc[0]); key != tc[1] {
+			t.Errorf("%q expected %q, got %q", tc[0], tc[1], key)
+		}
+	}
+	if err := validate(map[string]interface{}{
+		"log.sinks": "a", "log.sinks.a.writer": "journald",
+		"log.sinks.a.facility": "user",
+	}); err == nil {
+		t.Errorf("expected error")
+	}
+}
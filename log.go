@@ -1,9 +1,15 @@
 package log
 
+import "io"
+import "context"
 import "os"
 import "fmt"
 import "time"
+import "sync"
 import "strings"
+import "runtime"
+import "sync/atomic"
+import "strconv"
 import stdlog "log"
 
 import "github.com/prataprc/color"
@@ -17,6 +23,8 @@ func init() {
 		"log.file":         "",
 		"log.timeformat":   timeformat,
 		"log.prefix":       prefix,
+		"log.format":       "text",
+		"log.levelname":    "short",
 		"log.colorignore":  "",
 		"log.colorfatal":   "red",
 		"log.colorerror":   "hired",
@@ -29,7 +37,16 @@ func init() {
 	SetLogger(nil, setts)
 }
 
-var log Logger // can be used used off-the-shelf.
+var logref atomic.Value // loggerref, can be used used off-the-shelf.
+
+// loggerref wraps Logger, since atomic.Value requires all values to be
+// of the same concrete type.
+type loggerref struct{ Logger }
+
+// getlog return the default logger.
+func getlog() Logger {
+	return logref.Load().(loggerref).Logger
+}
 
 // DefaultLogLevel to use if log.level option is missing.
 var DefaultLogLevel = "info"
@@ -91,76 +108,196 @@ type Logger interface {
 
 	// Printlf reserved for future extension.
 	Printlf(loglevel LogLevel, format string, v ...interface{})
+
+	// With returns a child logger that carries the supplied key/value
+	// pairs, along with the fields of its parent, on every log record.
+	With(keyvals ...interface{}) Logger
+
+	// Fatalw similar to Fatalf, logs msg followed by key/value fields.
+	Fatalw(msg string, keyvals ...interface{})
+
+	// Errorw similar to Errorf, logs msg followed by key/value fields.
+	Errorw(msg string, keyvals ...interface{})
+
+	// Warnw similar to Warnf, logs msg followed by key/value fields.
+	Warnw(msg string, keyvals ...interface{})
+
+	// Infow similar to Infof, logs msg followed by key/value fields.
+	Infow(msg string, keyvals ...interface{})
+
+	// Verbosew similar to Verbosef, logs msg followed by key/value fields.
+	Verbosew(msg string, keyvals ...interface{})
+
+	// Debugw similar to Debugf, logs msg followed by key/value fields.
+	Debugw(msg string, keyvals ...interface{})
+
+	// Tracew similar to Tracef, logs msg followed by key/value fields.
+	Tracew(msg string, keyvals ...interface{})
+
+	// Printlw field aware version of Printlf.
+	Printlw(loglevel LogLevel, msg string, keyvals ...interface{})
+
+	// Enabled return whether records at level will be logged, useful
+	// to avoid building expensive log messages. Levels outside
+	// LogLevelIgnore and LogLevelTrace are never logged.
+	Enabled(level LogLevel) bool
+
+	// Sync flush buffered log records and commit them to stable
+	// storage.
+	Sync() error
+
+	// Close flush buffered log records and release resources like open
+	// files, logging after Close may fail silently.
+	Close() error
 }
 
 // LogLevel defines application log level.
 type LogLevel int
 
 const (
-	logLevelIgnore LogLevel = iota + 1
-	logLevelFatal
-	logLevelError
-	logLevelWarn
-	logLevelInfo
-	logLevelVerbose
-	logLevelDebug
-	logLevelTrace
+	LogLevelIgnore LogLevel = iota + 1
+	LogLevelFatal
+	LogLevelError
+	LogLevelWarn
+	LogLevelInfo
+	LogLevelVerbose
+	LogLevelDebug
+	LogLevelTrace
 )
 
 // SetLogger to integrate storage logging with application logging.
 // importing this package will initialize the logger with info level
-// logging to console.
+// logging to console. Previous logger, if any, is closed unless logger
+// shares its outputs, like a With() or Named() child. SetLogger panics
+// on invalid settings, use Configure() to get an error instead.
 func SetLogger(logger Logger, setts map[string]interface{}) Logger {
-	if logger != nil {
-		log = logger
-		return log
+	if logger == nil {
+		var err error
+		if logger, err = New(nil, setts); err != nil {
+			panic(err)
+		}
 	}
+	oldref := logref.Swap(loggerref{logger})
+	if oldref != nil {
+		if oldlog := oldref.(loggerref).Logger; !sharestate(oldlog, logger) {
+			oldlog.Close()
+		}
+	}
+	return logger
+}
 
-	var err error
+// sharestate return true if x and y write to the same sinks.
+func sharestate(x, y Logger) bool {
+	if x == y {
+		return true
+	}
+	dx, ok1 := x.(*defaultLogger)
+	dy, ok2 := y.(*defaultLogger)
+	return ok1 && ok2 && dx.logstate == dy.logstate
+}
 
-	logfd := os.Stdout
-	if logfile, ok := setts["log.file"]; ok {
-		filename := logfile.(string)
-		if filename != "" {
-			logfd, err = os.OpenFile(filename, os.O_RDWR|os.O_APPEND, 0660)
-			if err != nil {
-				if logfd, err = os.Create(filename); err != nil {
-					panic(err)
-				}
-			}
-		}
+// Configure the default logger using setts, returns an error listing
+// every invalid setting, in which case the default logger is left
+// unchanged. Previous logger is closed.
+func Configure(setts map[string]interface{}) error {
+	logger, err := New(nil, setts)
+	if err != nil {
+		return err
 	}
-	stdlog.SetOutput(logfd)
+	SetLogger(logger, nil)
+	return nil
+}
 
-	deflog := &defaultLogger{
-		timeformat: timeformat, prefix: prefix,
-		colors: make(map[LogLevel]*color.Color),
+// New create a logger instance that owns its output, flags and prefix,
+// independent of the default logger and golang's standard logger. Log
+// records are written to w, if w is nil, they are written to
+// "log.file" if supplied in setts, else to os.Stdout. Refer
+// Defaultsettings() for description on each settings parameter. All
+// settings are validated, refer Configure().
+func New(w io.Writer, setts map[string]interface{}) (Logger, error) {
+	if err := validate(setts); err != nil {
+		return nil, err
+	}
+
+	// settings are validated, hence parse errors are ignored below.
+	sinks, err := opensinks(w, setts)
+	if err != nil {
+		return nil, err
 	}
+	deflog := newlogger(sinks)
+	deflog.configure(setts)
+	return deflog, nil
+}
 
-	level, ok := setts["log.level"]
-	if ok == false {
+// configure format, level, flags, timeformat, prefix and colors from
+// validated setts, parameters missing in setts are left unchanged.
+// Applied to a live logger on reload, refer Watch().
+func (l *defaultLogger) configure(setts map[string]interface{}) {
+	if _, ok := setts["log.format"]; ok {
+		format, _ := settingstring(setts, "log.format")
+		format, _ = string2format(format)
+		l.update(func(cfg *logconfig) { cfg.format = format })
+	}
+
+	level, _ := settingstring(setts, "log.level")
+	if level == "" {
 		level = "info"
 	}
-	deflog.SetLogLevel(level.(string))
+	l.SetLogLevel(level)
+
+	if _, ok := setts["log.levelname"]; ok {
+		levelname, _ := settingstring(setts, "log.levelname")
+		fullname, _ := string2levelname(levelname)
+		l.update(func(cfg *logconfig) { cfg.fullname = fullname })
+	}
 
 	logflags := int(0)
-	if flags, ok := setts["log.flags"]; ok {
-		for _, flag := range parsecsv(flags.(string)) {
-			logflags |= string2flag(flag)
+	if l.config().format != "text" { // structured records carry their own time.
+		l.SetLogFlags(logflags)
+	} else if _, ok := setts["log.flags"]; ok {
+		flags, _ := settingcsv(setts, "log.flags")
+		for _, flag := range flags {
+			flag, _ := string2flag(flag)
+			logflags |= flag
 		}
-		deflog.SetLogFlags(logflags)
+		l.SetLogFlags(logflags)
 	}
 
 	if logflags == 0 {
-		if timeformat, ok := setts["log.timeformat"]; ok {
-			deflog.SetTimeFormat(timeformat.(string))
+		if _, ok := setts["log.timeformat"]; ok {
+			timeformat, _ := settingstring(setts, "log.timeformat")
+			l.SetTimeFormat(timeformat)
 		}
 	} else { // if flags are available disable timeformat.
-		deflog.SetTimeFormat("")
+		l.SetTimeFormat("")
 	}
 
 	if prefix, ok := setts["log.prefix"]; ok {
-		deflog.SetLogprefix(prefix)
+		l.SetLogprefix(prefix)
+	}
+
+	if _, ok := setts["log.v"]; ok {
+		v, _ := settingsize(setts, "log.v")
+		l.update(func(cfg *logconfig) { cfg.v = int(v) })
+	}
+	if _, ok := setts["log.vmodule"]; ok {
+		items, _ := settingcsv(setts, "log.vmodule")
+		vmodule, _ := parsevmodule(items)
+		l.update(func(cfg *logconfig) { cfg.vmodule = vmodule })
+	}
+
+	_, ok1 := setts["log.debugsites"]
+	if _, ok2 := setts["log.debugrules"]; ok1 || ok2 {
+		dd, _ := newdyndebug(setts)
+		l.update(func(cfg *logconfig) { cfg.dyndebug = dd })
+	}
+
+	for key := range setts {
+		if key == "log.levels" || strings.HasPrefix(key, "log.levels.") {
+			rules, _ := levelrules(setts)
+			l.update(func(cfg *logconfig) { cfg.levels = rules })
+			break
+		}
 	}
 
 	// colors
@@ -169,54 +306,152 @@ func SetLogger(logger Logger, setts map[string]interface{}) Logger {
 		"log.colortrace"}
 	for _, param := range params {
 		level := param[9:]
-		if val, ok := setts[param]; ok {
-			if v1, ok := val.(string); ok {
-				deflog.SetLogcolor(level, parsecsv(v1))
-			} else if v2, ok := val.([]string); ok {
-				deflog.SetLogcolor(level, v2)
-			} else {
-				fmsg := "invalid type: color parameter %q has %T"
-				panic(fmt.Errorf(fmsg, param, val))
-			}
+		if _, ok := setts[param]; ok {
+			attrs, _ := settingcsv(setts, param)
+			l.SetLogcolor(level, attrs)
 		}
 	}
+}
+
+// openoutput open "log.file" if configured, else return os.Stdout.
+// Refer newRotatingFile() for rotation settings.
+func openoutput(setts map[string]interface{}) (io.Writer, error) {
+	filename, _ := settingstring(setts, "log.file")
+	if filename == "" {
+		return os.Stdout, nil
+	}
+	return newRotatingFile(filename, setts)
+}
 
-	log = deflog
-	return log
+func openlogfile(filename string) (*os.File, error) {
+	fd, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND, 0660)
+	if err != nil {
+		return os.Create(filename)
+	}
+	return fd, nil
 }
 
 // defaultLogger with default log-file as os.Stdout and,
-// default log-level as logLevelInfo. Applications can
+// default log-level as LogLevelInfo. Applications can
 // supply a Logger{} object when instantiating the
 // Transport.
 type defaultLogger struct {
-	level      LogLevel
+	*logstate // shared with child loggers.
+	fields    []Field
+	name      string // component name, refer Named().
+}
+
+// logstate of a logger, shared with its child loggers. Log level is
+// accessed atomically and rest of the configuration is copy-on-write,
+// such that a logger can be reconfigured while other goroutines are
+// logging. Sinks are fixed for the life of the logger.
+type logstate struct {
+	level int64        // atomic LogLevel
+	conf  atomic.Value // *logconfig
+	cmu   sync.Mutex   // serialize configuration updates.
+	sinks []*sink
+	// needcaller is true if any sink is configured with json or logfmt
+	// format, or encodes caller on its own, such that callers are
+	// located irrespective of log.format.
+	needcaller bool
+}
+
+// logconfig is never modified once stored in logstate.
+type logconfig struct {
 	timeformat string
 	prefix     string
 	colors     map[LogLevel]*color.Color
+	colorattrs map[LogLevel][]string // attribute names, for Settings().
+	format     string
+	fullname   bool
+	flags      int
+	levels     []levelrule // for named loggers, longer prefix first.
+	v          int         // verbosity, refer V().
+	vmodule    *vmodule
+	dyndebug   *dyndebug // nil if dynamic debug is not active.
+}
+
+// structtimeformat return time format for json and logfmt records,
+// RFC3339Nano unless "log.timeformat" is changed from its default.
+func (cfg *logconfig) structtimeformat() string {
+	if cfg.timeformat == timeformat {
+		return time.RFC3339Nano
+	}
+	return cfg.timeformat
+}
+
+func newDefaultLogger(out io.Writer) *defaultLogger {
+	return newlogger([]*sink{newsink("", outputkind(out), out)})
+}
+
+func newlogger(sinks []*sink) *defaultLogger {
+	l := &defaultLogger{logstate: &logstate{sinks: sinks}}
+	for _, s := range sinks {
+		structured := s.format != "" && s.format != "text"
+		l.needcaller = l.needcaller || structured || s.kind == "journald"
+	}
+	l.conf.Store(&logconfig{
+		timeformat: timeformat, prefix: prefix,
+		colors: make(map[LogLevel]*color.Color), format: "text",
+		colorattrs: make(map[LogLevel][]string),
+	})
+	atomic.StoreInt64(&l.level, int64(LogLevelInfo))
+	return l
+}
+
+// config return current configuration, shall not be modified.
+func (l *defaultLogger) config() *logconfig {
+	return l.conf.Load().(*logconfig)
+}
+
+// update configuration by applying fn on a copy of the current
+// configuration.
+func (l *defaultLogger) update(fn func(cfg *logconfig)) {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+
+	cfg := *l.config()
+	cfg.colors = make(map[LogLevel]*color.Color)
+	for level, color := range l.config().colors {
+		cfg.colors[level] = color
+	}
+	cfg.colorattrs = make(map[LogLevel][]string)
+	for level, attrs := range l.config().colorattrs {
+		cfg.colorattrs[level] = attrs
+	}
+	fn(&cfg)
+	l.conf.Store(&cfg)
+}
+
+func (l *defaultLogger) loglevel() LogLevel {
+	return LogLevel(atomic.LoadInt64(&l.level))
 }
 
 // SetLogLevel for defaultLogger.
 func (l *defaultLogger) SetLogLevel(level string) {
-	l.level = string2logLevel(level)
+	ll, err := ParseLevel(level)
+	if err != nil {
+		panic(err)
+	}
+	atomic.StoreInt64(&l.level, int64(ll))
 }
 
 // SetLogFlags for defaultLogger.
 func (l *defaultLogger) SetLogFlags(flags int) {
-	stdlog.SetFlags(flags)
+	l.update(func(cfg *logconfig) { cfg.flags = flags })
 }
 
 // SetTimeFormat for defaultLogger.
 func (l *defaultLogger) SetTimeFormat(format string) {
-	l.timeformat = format
+	l.update(func(cfg *logconfig) { cfg.timeformat = format })
 }
 
 // SetLogprefix for defaultLogger
 func (l *defaultLogger) SetLogprefix(prefix interface{}) {
 	if val, ok := prefix.(string); ok {
-		l.prefix = val
+		l.update(func(cfg *logconfig) { cfg.prefix = val })
 	} else if _, ok = prefix.(bool); ok {
-		l.prefix = ""
+		l.update(func(cfg *logconfig) { cfg.prefix = "" })
 	} else {
 		panic("level-prefix can either be string format, or bool")
 	}
@@ -224,72 +459,263 @@ func (l *defaultLogger) SetLogprefix(prefix interface{}) {
 
 // SetLogcolor for defaultLogger
 func (l *defaultLogger) SetLogcolor(level string, attrs []string) {
-	ll := string2logLevel(level)
+	ll, err := ParseLevel(level)
+	if err != nil {
+		panic(err)
+	}
 	attributes := []color.Attribute{}
 	for _, attr := range attrs {
-		attributes = append(attributes, string2clrattr(attr))
+		attribute, err := string2clrattr(attr)
+		if err != nil {
+			panic(err)
+		}
+		attributes = append(attributes, attribute)
 	}
-	l.colors[ll] = color.New(attributes...)
+	color, attrs := color.New(attributes...), append([]string{}, attrs...)
+	l.update(func(cfg *logconfig) {
+		cfg.colors[ll], cfg.colorattrs[ll] = color, attrs
+	})
 }
 
 // Fatalf for defaultLogger
 func (l *defaultLogger) Fatalf(format string, v ...interface{}) {
-	l.Printlf(logLevelFatal, format, v...)
+	l.Printlf(LogLevelFatal, format, v...)
 }
 
 // Errorf for defaultLogger
 func (l *defaultLogger) Errorf(format string, v ...interface{}) {
-	l.Printlf(logLevelError, format, v...)
+	l.Printlf(LogLevelError, format, v...)
 }
 
 // Warnf for defaultLogger
 func (l *defaultLogger) Warnf(format string, v ...interface{}) {
-	l.Printlf(logLevelWarn, format, v...)
+	l.Printlf(LogLevelWarn, format, v...)
 }
 
 // Infof for defaultLogger
 func (l *defaultLogger) Infof(format string, v ...interface{}) {
-	l.Printlf(logLevelInfo, format, v...)
+	l.Printlf(LogLevelInfo, format, v...)
 }
 
 // Verbosef for defaultLogger
 func (l *defaultLogger) Verbosef(format string, v ...interface{}) {
-	l.Printlf(logLevelVerbose, format, v...)
+	l.Printlf(LogLevelVerbose, format, v...)
 }
 
 // Debugf for defaultLogger
 func (l *defaultLogger) Debugf(format string, v ...interface{}) {
-	l.Printlf(logLevelDebug, format, v...)
+	l.Printlf(LogLevelDebug, format, v...)
 }
 
 // Tracef for defaultLogger
 func (l *defaultLogger) Tracef(format string, v ...interface{}) {
-	l.Printlf(logLevelTrace, format, v...)
+	l.Printlf(LogLevelTrace, format, v...)
 }
 
 // Printlf for defaultLogger
 func (l *defaultLogger) Printlf(level LogLevel, frmt string, v ...interface{}) {
-	if l.canlog(level) {
-		prefix := ""
-		if l.timeformat != "" {
-			prefix = time.Now().Format(l.timeformat) + " "
-		}
-		if lstr := level.String(); lstr != "" && l.prefix != "" {
-			prefix += fmt.Sprintf(l.prefix, level.String()) + " "
-		}
-		newv := []interface{}{prefix}
-		newv = append(newv, v...)
-		frmt := trimformat(frmt) // output appends a newline because of color
-		if color, ok := l.colors[level]; ok && color != nil {
-			stdlog.Output(3, color.Sprintf("%v"+frmt, newv...))
+	if l.dynenabled(2, level, frmt) || l.Enabled(level) {
+		l.output(level, fmt.Sprintf(trimformat(frmt), v...), nil)
+	}
+}
+
+// output shall be called only from Printlf and Printlw, such that
+// caller can be located for Lshortfile and Llongfile flags.
+func (l *defaultLogger) output(level LogLevel, msg string, fields []Field) {
+	var pcs [1]uintptr
+	if cfg := l.config(); cfg.format != "text" || l.needcaller ||
+		cfg.flags&(stdlog.Lshortfile|stdlog.Llongfile) != 0 {
+
+		runtime.Callers(4, pcs[:])
+	}
+	l.emit(time.Now(), level, msg, fields, pcs[0])
+}
+
+// emit a record logged at when, from the call site at pc, pc can be
+// zero if caller is not known or not required. Record is encoded once
+// for every distinct format and color among the accepting sinks.
+func (l *defaultLogger) emit(
+	when time.Time, level LogLevel, msg string, fields []Field, pc uintptr) {
+
+	r := record{
+		when: when, level: level, msg: msg, name: l.name, pc: pc,
+		fields: joinfields(l.fields, fields),
+	}
+
+	cfg := l.config()
+	type encoded struct {
+		format string
+		color  bool
+		line   []byte
+	}
+	var lines [2]encoded // typically not more than two kinds of sinks.
+	cache := lines[:0]
+
+	for _, s := range l.sinks {
+		if !s.accept(level) {
+			continue
+		} else if s.enc != nil {
+			s.write(level, s.enc.encoderecord(&r))
+			continue
+		}
+		format := s.format
+		if format == "" {
+			format = cfg.format
+		}
+		var line []byte
+		for _, e := range cache {
+			if e.format == format && e.color == s.color {
+				line = e.line
+				break
+			}
+		}
+		if line == nil {
+			line = l.encode(cfg, &r, format, s.color, pc)
+			cache = append(cache, encoded{format, s.color, line})
+		}
+		s.write(level, line)
+	}
+}
+
+// encode record in format, newline terminated.
+func (l *defaultLogger) encode(
+	cfg *logconfig, r *record, format string, colored bool, pc uintptr) []byte {
+
+	var line []byte
+	switch format {
+	case "json":
+		r.caller = shortcaller(callerinfo(pc))
+		line = encodejson(nil, r, cfg.structtimeformat(), cfg.fullname)
+
+	case "logfmt":
+		r.caller = shortcaller(callerinfo(pc))
+		line = encodelogfmt(nil, r, cfg.structtimeformat(), cfg.fullname)
+
+	default:
+		file, lineno := "", 0
+		if cfg.flags&(stdlog.Lshortfile|stdlog.Llongfile) != 0 {
+			file, lineno = callerinfo(pc)
+		}
+		line = appendheader(nil, r.when, file, lineno, cfg.flags)
+		if cfg.timeformat != "" {
+			line = append(line, r.when.Format(cfg.timeformat)...)
+			line = append(line, ' ')
+		}
+		if lstr := r.level.name(cfg.fullname); lstr != "" && cfg.prefix != "" {
+			line = append(line, fmt.Sprintf(cfg.prefix, lstr)...)
+			line = append(line, ' ')
+		}
+		if l.name != "" {
+			line = append(append(line, l.name...), ": "...)
+		}
+		text := string(appendfields(append(line, r.msg...), r.fields))
+		if color, ok := cfg.colors[r.level]; ok && color != nil && colored {
+			text = color.Sprintf("%v", text)
+		}
+		line = []byte(text)
+	}
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	return line
+}
+
+// Sync for defaultLogger, wait for queued records to be written and
+// commit log files to stable storage.
+func (l *defaultLogger) Sync() error {
+	if err := l.Flush(); err != nil {
+		return err
+	}
+	for _, s := range l.sinks {
+		if f := s.logfile(); f != nil {
+			if err := f.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close for defaultLogger, drain queued records and close log files.
+// Note that child loggers created using With() share the output with
+// their parent, hence closing one closes all of them.
+func (l *defaultLogger) Close() error {
+	var err error
+	for _, s := range l.sinks {
+		if cerr := s.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reopen for defaultLogger, a no-op if logger is not writing to
+// log files.
+func (l *defaultLogger) Reopen() error {
+	var err error
+	for _, s := range l.sinks {
+		if f := s.logfile(); f != nil {
+			if rerr := f.Reopen(); err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
+// Settings for defaultLogger, return effective settings, reflecting
+// changes made after the logger was created.
+func (l *defaultLogger) Settings() map[string]interface{} {
+	cfg, levelname := l.config(), "short"
+	if cfg.fullname {
+		levelname = "full"
+	}
+	setts := map[string]interface{}{
+		"log.level":      l.loglevel().Name(),
+		"log.flags":      flag2string(cfg.flags),
+		"log.file":       "",
+		"log.timeformat": cfg.timeformat,
+		"log.prefix":     cfg.prefix,
+		"log.format":     cfg.format,
+		"log.levelname":  levelname,
+		"log.async":      false,
+		"log.levels":     rules2string(cfg.levels),
+		"log.v":          cfg.v,
+		"log.vmodule":    cfg.vmodule.String(),
+		"log.debugsites": false,
+		"log.debugrules": "",
+	}
+	if dd := cfg.dyndebug; dd != nil {
+		setts["log.debugsites"] = dd.track
+		setts["log.debugrules"] = strings.Join(dd.specs(), "; ")
+	}
+	names := []string{}
+	for _, s := range l.sinks {
+		if s.name == "" { // log.file
+			if f := s.logfile(); f != nil {
+				setts["log.file"] = f.name()
+			}
 		} else {
-			stdlog.Output(3, fmt.Sprintf("%v"+frmt, newv...))
+			names = append(names, s.name)
+			s.settings(setts)
+		}
+		if _, ok := s.out.(*asyncWriter); ok {
+			setts["log.async"] = true
 		}
 	}
+	setts["log.sinks"] = strings.Join(names, ",")
+	for level := LogLevelIgnore; level <= LogLevelTrace; level++ {
+		attrs := cfg.colorattrs[level]
+		setts["log.color"+level.Name()] = strings.Join(attrs, ",")
+	}
+	return setts
 }
 
-func (l *defaultLogger) canlog(level LogLevel) bool {
-	if level <= l.level {
+// Enabled for defaultLogger.
+func (l *defaultLogger) Enabled(level LogLevel) bool {
+	if level < LogLevelIgnore || level > LogLevelTrace {
+		return false
+	} else if level <= l.effectivelevel() {
 		return true
 	}
 	return false
@@ -297,156 +723,296 @@ func (l *defaultLogger) canlog(level LogLevel) bool {
 
 func (l LogLevel) String() string {
 	switch l {
-	case logLevelIgnore:
+	case LogLevelIgnore:
 		return "Ignor"
-	case logLevelFatal:
+	case LogLevelFatal:
 		return "Fatal"
-	case logLevelError:
+	case LogLevelError:
 		return "Error"
-	case logLevelWarn:
+	case LogLevelWarn:
 		return "Warng"
-	case logLevelInfo:
+	case LogLevelInfo:
 		return "Infom"
-	case logLevelVerbose:
+	case LogLevelVerbose:
 		return "Verbs"
-	case logLevelDebug:
+	case LogLevelDebug:
 		return "Debug"
-	case logLevelTrace:
+	case LogLevelTrace:
 		return "Trace"
 	}
 	panic("unexpected log level") // should never reach here
 }
 
-func string2logLevel(s string) LogLevel {
-	s = strings.ToLower(s)
-	switch s {
-	case "ignore":
-		return logLevelIgnore
+// Name return full lower case name of log level, same as the names
+// accepted by SetLogLevel() and ParseLevel().
+func (l LogLevel) Name() string {
+	switch l {
+	case LogLevelIgnore:
+		return "ignore"
+	case LogLevelFatal:
+		return "fatal"
+	case LogLevelError:
+		return "error"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelVerbose:
+		return "verbose"
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelTrace:
+		return "trace"
+	}
+	panic("unexpected log level") // should never reach here
+}
+
+func (l LogLevel) name(full bool) string {
+	if full {
+		return l.Name()
+	}
+	return l.String()
+}
+
+// ParseLevel parse log level name, case insensitive, can be one of
+// "ignore", "fatal", "error", "warn", "info", "verbose", "debug",
+// "trace", or its five letter name like "Infom", "Warng".
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(s) {
+	case "ignore", "ignor":
+		return LogLevelIgnore, nil
 	case "fatal":
-		return logLevelFatal
+		return LogLevelFatal, nil
 	case "error":
-		return logLevelError
-	case "warn":
-		return logLevelWarn
-	case "info":
-		return logLevelInfo
-	case "verbose":
-		return logLevelVerbose
+		return LogLevelError, nil
+	case "warn", "warng":
+		return LogLevelWarn, nil
+	case "info", "infom":
+		return LogLevelInfo, nil
+	case "verbose", "verbs":
+		return LogLevelVerbose, nil
 	case "debug":
-		return logLevelDebug
+		return LogLevelDebug, nil
 	case "trace":
-		return logLevelTrace
+		return LogLevelTrace, nil
 	}
-	panic(fmt.Errorf("unexpected log level: %q", s)) // never reach here
+	return 0, fmt.Errorf("unexpected log level: %q", s)
 }
 
-func string2clrattr(s string) color.Attribute {
+// MarshalText implement encoding.TextMarshaler, level is marshaled
+// using its full name.
+func (l LogLevel) MarshalText() ([]byte, error) {
+	if l < LogLevelIgnore || l > LogLevelTrace {
+		return nil, fmt.Errorf("unexpected log level: %d", int(l))
+	}
+	return []byte(l.Name()), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler, refer ParseLevel.
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+func string2clrattr(s string) (color.Attribute, error) {
 	s = strings.ToLower(s)
 	switch s {
 	case "bold":
-		return color.Bold
+		return color.Bold, nil
 	case "underline":
-		return color.Underline
+		return color.Underline, nil
 	case "blinkslow":
-		return color.BlinkSlow
+		return color.BlinkSlow, nil
 	case "blinkrapid":
-		return color.BlinkRapid
+		return color.BlinkRapid, nil
 	case "crossedout":
-		return color.CrossedOut
+		return color.CrossedOut, nil
 	case "red":
-		return color.FgRed
+		return color.FgRed, nil
 	case "green":
-		return color.FgGreen
+		return color.FgGreen, nil
 	case "yellow":
-		return color.FgYellow
+		return color.FgYellow, nil
 	case "blue":
-		return color.FgBlue
+		return color.FgBlue, nil
 	case "magenta":
-		return color.FgMagenta
+		return color.FgMagenta, nil
 	case "cyan":
-		return color.FgCyan
+		return color.FgCyan, nil
 	case "white":
-		return color.FgWhite
+		return color.FgWhite, nil
 	case "hired":
-		return color.FgHiRed
+		return color.FgHiRed, nil
 	case "higreen":
-		return color.FgHiGreen
+		return color.FgHiGreen, nil
 	case "hiyellow":
-		return color.FgHiYellow
+		return color.FgHiYellow, nil
 	case "hiblue":
-		return color.FgHiBlue
+		return color.FgHiBlue, nil
 	case "himagenta":
-		return color.FgHiMagenta
+		return color.FgHiMagenta, nil
 	case "hicyan":
-		return color.FgHiCyan
+		return color.FgHiCyan, nil
 	case "hiwhite":
-		return color.FgHiWhite
+		return color.FgHiWhite, nil
 	}
-	panic(fmt.Errorf("unexpected color attribute %q", s)) // never reach here
+	return 0, fmt.Errorf("unexpected color attribute %q", s)
 }
 
-func string2flag(s string) int {
+func string2flag(s string) (int, error) {
 	s = strings.ToLower(s)
 	switch s {
 	case "ldate":
-		return stdlog.Ldate
+		return stdlog.Ldate, nil
 	case "ltime":
-		return stdlog.Ltime
+		return stdlog.Ltime, nil
 	case "lmicroseconds":
-		return stdlog.Lmicroseconds
+		return stdlog.Lmicroseconds, nil
 	case "llongfile":
-		return stdlog.Llongfile
+		return stdlog.Llongfile, nil
 	case "lshortfile":
-		return stdlog.Lshortfile
+		return stdlog.Lshortfile, nil
 	case "lutc":
-		return stdlog.LUTC
+		return stdlog.LUTC, nil
 	case "lstdflags":
-		return stdlog.LstdFlags
+		return stdlog.LstdFlags, nil
 	}
-	panic(fmt.Errorf("unexpected color attribute %q", s)) // never reach here
+	return 0, fmt.Errorf("unexpected flag %q", s)
+}
+
+// flag2string is the inverse of string2flag, return comma separated
+// flags.
+func flag2string(flags int) string {
+	names := []string{
+		"ldate", "ltime", "lmicroseconds", "llongfile", "lshortfile", "lutc",
+	}
+	ss := []string{}
+	for i, name := range names {
+		if flags&(1<<uint(i)) != 0 {
+			ss = append(ss, name)
+		}
+	}
+	return strings.Join(ss, ",")
+}
+
+func string2format(s string) (string, error) {
+	s = strings.ToLower(s)
+	switch s {
+	case "", "text":
+		return "text", nil
+	case "json":
+		return "json", nil
+	case "logfmt":
+		return "logfmt", nil
+	}
+	return "", fmt.Errorf("unexpected log format %q", s)
+}
+
+func string2levelname(s string) (bool, error) {
+	s = strings.ToLower(s)
+	switch s {
+	case "", "short":
+		return false, nil
+	case "full":
+		return true, nil
+	}
+	return false, fmt.Errorf("unexpected level name %q", s)
 }
 
 // Fatalf similar to Printf, will be logged only when log level is set as
 // "fatal" or above.
 func Fatalf(format string, v ...interface{}) {
-	log.Printlf(logLevelFatal, format, v...)
+	getlog().Printlf(LogLevelFatal, format, v...)
+	getlog().Sync()
 	panic(fmt.Errorf(format, v...))
 }
 
 // Errorf similar to Printf, will be logged only when log level is set as
 // "error" or above.
 func Errorf(format string, v ...interface{}) {
-	log.Printlf(logLevelError, format, v...)
+	getlog().Printlf(LogLevelError, format, v...)
 }
 
 // Warnf similar to Printf, will be logged only when log level is set as
 // "warn" or above.
 func Warnf(format string, v ...interface{}) {
-	log.Printlf(logLevelWarn, format, v...)
+	getlog().Printlf(LogLevelWarn, format, v...)
 }
 
 // Infof similar to Printf, will be logged only when log level is set as
 // "info" or above.
 func Infof(format string, v ...interface{}) {
-	log.Printlf(logLevelInfo, format, v...)
+	getlog().Printlf(LogLevelInfo, format, v...)
 }
 
 // Verbosef similar to Printf, will be logged only when log level is set as
 // "verbose" or above.
 func Verbosef(format string, v ...interface{}) {
-	log.Printlf(logLevelVerbose, format, v...)
+	getlog().Printlf(LogLevelVerbose, format, v...)
 }
 
 // Debugf similar to Printf, will be logged only when log level is set as
 // "debug" or above.
 func Debugf(format string, v ...interface{}) {
-	log.Printlf(logLevelDebug, format, v...)
+	getlog().Printlf(LogLevelDebug, format, v...)
 }
 
 // Tracef similar to Printf, will be logged only when log level is set as
 // "trace" or above.
 func Tracef(format string, v ...interface{}) {
-	log.Printlf(logLevelTrace, format, v...)
+	getlog().Printlf(LogLevelTrace, format, v...)
+}
+
+// Shutdown flush and close the default logger, waiting until ctx is
+// done.
+func Shutdown(ctx context.Context) error {
+	errch := make(chan error, 1)
+	go func(logger Logger) { errch <- logger.Close() }(getlog())
+	select {
+	case err := <-errch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reopen log file of the default logger, useful when the file is
+// renamed by external tools like logrotate. Custom loggers can support
+// Reopen by implementing a Reopen() error method.
+func Reopen() error {
+	if logger, ok := getlog().(interface{ Reopen() error }); ok {
+		return logger.Reopen()
+	}
+	return nil
+}
+
+// Settings return effective settings of the default logger, refer
+// Defaultsettings(). Custom loggers can support Settings by
+// implementing a Settings() map[string]interface{} method, else only
+// "log.level" is reported.
+func Settings() map[string]interface{} {
+	logger := getlog()
+	if logger, ok := logger.(interface {
+		Settings() map[string]interface{}
+	}); ok {
+		return logger.Settings()
+	}
+	for level := LogLevelTrace; level > LogLevelIgnore; level-- {
+		if logger.Enabled(level) {
+			return map[string]interface{}{"log.level": level.Name()}
+		}
+	}
+	return map[string]interface{}{"log.level": LogLevelIgnore.Name()}
+}
+
+// Enabled return whether records at level will be logged by the
+// default logger.
+func Enabled(level LogLevel) bool {
+	return getlog().Enabled(level)
 }
 
 // Consolef similar to Printf, will log to os.Stdout.
@@ -470,8 +1036,130 @@ func parsecsv(input string) []string {
 	return outs
 }
 
+// settingsize return integer value for key, string values can have
+// a KB, MB or GB suffix. Missing key is treated as zero.
+func settingsize(setts map[string]interface{}, key string) (int64, error) {
+	switch val := setts[key].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(val), nil
+	case int64:
+		return val, nil
+	case float64:
+		return int64(val), nil
+	case string:
+		s, unit := strings.ToUpper(strings.TrimSpace(val)), int64(1)
+		for suffix, n := range sizeunits {
+			if strings.HasSuffix(s, suffix) {
+				s, unit = strings.TrimSpace(strings.TrimSuffix(s, suffix)), n
+				break
+			}
+		}
+		if s == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %q: %v", key, err)
+		}
+		return n * unit, nil
+	}
+	fmsg := "invalid type: parameter %q has %T"
+	return 0, fmt.Errorf(fmsg, key, setts[key])
+}
+
+var sizeunits = map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30}
+
+// settingstring return string value for key. Missing key is treated
+// as empty string.
+func settingstring(setts map[string]interface{}, key string) (string, error) {
+	switch val := setts[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	}
+	fmsg := "invalid type: parameter %q has %T"
+	return "", fmt.Errorf(fmsg, key, setts[key])
+}
+
+// settingcsv return list of strings for key, string values are
+// parsed as comma separated values, []interface{} values, as decoded
+// from JSON, shall only contain strings. Missing key is treated as
+// empty.
+func settingcsv(setts map[string]interface{}, key string) ([]string, error) {
+	switch val := setts[key].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return parsecsv(val), nil
+	case []string:
+		return val, nil
+	case []interface{}:
+		ss := make([]string, 0, len(val))
+		for _, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				fmsg := "invalid type: parameter %q has %T item"
+				return nil, fmt.Errorf(fmsg, key, item)
+			}
+			ss = append(ss, s)
+		}
+		return ss, nil
+	}
+	fmsg := "invalid type: parameter %q has %T"
+	return nil, fmt.Errorf(fmsg, key, setts[key])
+}
+
+// settingbool return boolean value for key, string values are parsed
+// using strconv.ParseBool. Missing key is treated as false.
+func settingbool(setts map[string]interface{}, key string) (bool, error) {
+	switch val := setts[key].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return val, nil
+	case string:
+		if val == "" {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return false, fmt.Errorf("invalid value for %q: %v", key, err)
+		}
+		return b, nil
+	}
+	fmsg := "invalid type: parameter %q has %T"
+	return false, fmt.Errorf(fmsg, key, setts[key])
+}
+
+// settingduration return duration value for key, string values are
+// parsed using time.ParseDuration. Missing key is treated as zero.
+func settingduration(
+	setts map[string]interface{}, key string) (time.Duration, error) {
+
+	switch val := setts[key].(type) {
+	case nil:
+		return 0, nil
+	case time.Duration:
+		return val, nil
+	case string:
+		if val == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %q: %v", key, err)
+		}
+		return d, nil
+	}
+	fmsg := "invalid type: parameter %q has %T"
+	return 0, fmt.Errorf(fmsg, key, setts[key])
+}
+
 func trimformat(frmt string) string {
-	if frmt[len(frmt)-1] == '\n' {
+	if frmt != "" && frmt[len(frmt)-1] == '\n' {
 		return frmt[:len(frmt)-1]
 	}
 	return frmt
@@ -1,5 +1,10 @@
 package log
 
+import "time"
+import "context"
+import "path/filepath"
+import "bytes"
+import "sync"
 import "testing"
 import "fmt"
 import "os"
@@ -14,9 +19,10 @@ func TestSetLogger(t *testing.T) {
 	logline := "hello world"
 	defer os.Remove(logfile)
 
-	ref := &defaultLogger{level: logLevelIgnore}
+	ref := newDefaultLogger(os.Stdout)
+	ref.SetLogLevel("ignore")
 	log := SetLogger(ref, nil).(*defaultLogger)
-	if log.level != logLevelIgnore {
+	if log.loglevel() != LogLevelIgnore {
 		t.Errorf("expected %v, got %v", ref, log)
 	}
 
@@ -43,6 +49,33 @@ func TestSetLogger(t *testing.T) {
 	}
 }
 
+func TestSetLoggerChild(t *testing.T) {
+	logfile := filepath.Join(t.TempDir(), "child.log")
+	setts := map[string]interface{}{
+		"log.level": "info", "log.file": logfile, "log.timeformat": "",
+	}
+	parent := SetLogger(nil, setts)
+	defer SetLogger(nil, Defaultsettings())
+
+	// children share the parent's outputs, installing them shall not
+	// close the parent.
+	SetLogger(parent.With("key", 1), nil)
+	SetLogger(parent.(*defaultLogger).Named("db"), nil)
+	Infof("hello")
+	parent.Infof("world")
+	if err := parent.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "[Infom] db: hello\n[Infom] world\n"
+	if s := string(data); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+}
+
 func TestLogTimeformat(t *testing.T) {
 	timeformat := "2006"
 	setts := map[string]interface{}{
@@ -50,8 +83,8 @@ func TestLogTimeformat(t *testing.T) {
 		"log.timeformat": timeformat,
 	}
 	log := SetLogger(nil, setts).(*defaultLogger)
-	if log.timeformat != timeformat {
-		t.Errorf("expected %v, got %v", timeformat, log.timeformat)
+	if s := log.config().timeformat; s != timeformat {
+		t.Errorf("expected %v, got %v", timeformat, s)
 	}
 }
 
@@ -62,7 +95,7 @@ func TestLogColor(t *testing.T) {
 		"log.colorfatal": attrs,
 	}
 	log := SetLogger(nil, setts).(*defaultLogger)
-	s := fmt.Sprintf("%T", log.colors[logLevelFatal])
+	s := fmt.Sprintf("%T", log.config().colors[LogLevelFatal])
 	if s != "*color.Color" {
 		t.Errorf("expected *color.Color, %v", s)
 	}
@@ -71,52 +104,96 @@ func TestLogColor(t *testing.T) {
 func TestSetLogPrefix(t *testing.T) {
 	setts := map[string]interface{}{"log.prefix": "[%v]"}
 	log := SetLogger(nil, setts).(*defaultLogger)
-	if log.prefix != "[%v]" {
-		t.Errorf("expected %v, got %v", "[%v]", log.prefix)
+	if s := log.config().prefix; s != "[%v]" {
+		t.Errorf("expected %v, got %v", "[%v]", s)
 	}
 	log.SetLogprefix(false)
-	if log.prefix != "" {
-		t.Errorf("expected empty prefix, %v", log.prefix)
+	if s := log.config().prefix; s != "" {
+		t.Errorf("expected empty prefix, %v", s)
 	}
 }
 
 func TestLogPrefix(t *testing.T) {
-	if ref, s := "Ignor", logLevelIgnore.String(); ref != s {
+	if ref, s := "Ignor", LogLevelIgnore.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
-	} else if ref, s = "Fatal", logLevelFatal.String(); ref != s {
+	} else if ref, s = "Fatal", LogLevelFatal.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
-	} else if ref, s = "Error", logLevelError.String(); ref != s {
+	} else if ref, s = "Error", LogLevelError.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
-	} else if ref, s = "Warng", logLevelWarn.String(); ref != s {
+	} else if ref, s = "Warng", LogLevelWarn.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
-	} else if ref, s = "Infom", logLevelInfo.String(); ref != s {
+	} else if ref, s = "Infom", LogLevelInfo.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
-	} else if ref, s = "Verbs", logLevelVerbose.String(); ref != s {
+	} else if ref, s = "Verbs", LogLevelVerbose.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
-	} else if ref, s = "Debug", logLevelDebug.String(); ref != s {
+	} else if ref, s = "Debug", LogLevelDebug.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
-	} else if ref, s = "Trace", logLevelTrace.String(); ref != s {
+	} else if ref, s = "Trace", LogLevelTrace.String(); ref != s {
 		t.Errorf("expected %v, got %v", ref, s)
 	}
 }
 
 func TestLogLevelSettings(t *testing.T) {
-	if r, l := logLevelIgnore, string2logLevel("ignore"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
-	} else if r, l = logLevelFatal, string2logLevel("fatal"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
-	} else if r, l = logLevelError, string2logLevel("error"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
-	} else if r, l = logLevelWarn, string2logLevel("warn"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
-	} else if r, l = logLevelInfo, string2logLevel("info"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
-	} else if r, l = logLevelVerbose, string2logLevel("verbose"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
-	} else if r, l = logLevelDebug, string2logLevel("debug"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
-	} else if r, l = logLevelTrace, string2logLevel("trace"); r != l {
-		t.Errorf("expected %v, got %v", r, l)
+	testcases := [][]interface{}{
+		[]interface{}{"ignore", LogLevelIgnore},
+		[]interface{}{"fatal", LogLevelFatal},
+		[]interface{}{"error", LogLevelError},
+		[]interface{}{"warn", LogLevelWarn},
+		[]interface{}{"info", LogLevelInfo},
+		[]interface{}{"verbose", LogLevelVerbose},
+		[]interface{}{"debug", LogLevelDebug},
+		[]interface{}{"trace", LogLevelTrace},
+		[]interface{}{"Infom", LogLevelInfo},
+		[]interface{}{"WARNG", LogLevelWarn},
+	}
+	for _, tc := range testcases {
+		ref := tc[1].(LogLevel)
+		if l, err := ParseLevel(tc[0].(string)); err != nil {
+			t.Error(err)
+		} else if l != ref {
+			t.Errorf("expected %v, got %v", ref, l)
+		}
+		var l LogLevel
+		if text, err := ref.MarshalText(); err != nil {
+			t.Error(err)
+		} else if err := l.UnmarshalText(text); err != nil {
+			t.Error(err)
+		} else if l != ref {
+			t.Errorf("expected %v, got %v", ref, l)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Errorf("expected error")
+	} else if _, err := LogLevel(100).MarshalText(); err == nil {
+		t.Errorf("expected error")
+	}
+
+	setts := map[string]interface{}{"log.level": "warn"}
+	logger, _ := New(ioutil.Discard, setts)
+	if !logger.Enabled(LogLevelError) || logger.Enabled(LogLevelInfo) {
+		t.Errorf("unexpected Enabled() for warn level")
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+	if !Enabled(LogLevelWarn) || Enabled(LogLevelDebug) {
+		t.Errorf("unexpected Enabled() for warn level")
+	}
+
+	// out of range levels are never logged.
+	var buf bytes.Buffer
+	setts = map[string]interface{}{
+		"log.level": "trace", "log.format": "json", "log.debugrules": "file=*",
+	}
+	logger, _ = New(&buf, setts)
+	for _, level := range []LogLevel{0, -1, LogLevelTrace + 1} {
+		if logger.Enabled(level) {
+			t.Errorf("unexpected Enabled() for %d", int(level))
+		}
+		logger.Printlf(level, "hello")
+		logger.Printlw(level, "hello", "n", 1)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected %q", buf.String())
 	}
 }
 
@@ -144,10 +221,15 @@ func TestColorAttrs(t *testing.T) {
 	}
 	for _, tc := range testcases {
 		s := tc[0].(string)
-		if v := string2clrattr(s); v != tc[1].(color.Attribute) {
+		if v, err := string2clrattr(s); err != nil {
+			t.Error(err)
+		} else if v != tc[1].(color.Attribute) {
 			t.Errorf("expected %v, got %v", tc[1], v)
 		}
 	}
+	if _, err := string2clrattr("purple"); err == nil {
+		t.Errorf("expected error")
+	}
 }
 
 func TestFlagAttr(t *testing.T) {
@@ -162,8 +244,233 @@ func TestFlagAttr(t *testing.T) {
 	}
 	for _, tc := range testcases {
 		s := tc[0].(string)
-		if v := string2flag(s); v != tc[1].(int) {
+		if v, err := string2flag(s); err != nil {
+			t.Error(err)
+		} else if v != tc[1].(int) {
 			t.Errorf("expected %v, got %v", tc[1], v)
 		}
 	}
+	if _, err := string2flag("lfoo"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	setts := map[string]interface{}{
+		"log.level": "info", "log.flags": "lshortfile",
+	}
+	log1, err := New(&buf1, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setts = map[string]interface{}{"log.level": "warn", "log.timeformat": ""}
+	log2, err := New(&buf2, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdflags := stdlog.Flags()
+	log1.Infof("hello %v", 1)
+	log2.Infof("hello %v", 2)
+	log2.Warnf("hello %v", 3)
+	if s, ref := buf1.String(), "log_test.go:"; !strings.HasPrefix(s, ref) {
+		t.Errorf("expected prefix %q, got %q", ref, s)
+	} else if !strings.HasSuffix(s, "[Infom] hello 1\n") {
+		t.Errorf("unexpected %q", s)
+	}
+	if s, ref := buf2.String(), "[Warng] hello 3\n"; s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+	if flags := stdlog.Flags(); flags != stdflags {
+		t.Errorf("standard logger flags changed from %v to %v", stdflags, flags)
+	}
+
+	setts = map[string]interface{}{"log.file": "/nonexistent/dir/log.file"}
+	if _, err := New(nil, setts); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestAppendheader(t *testing.T) {
+	now := time.Date(2009, 1, 23, 1, 23, 23, 123123000, time.UTC)
+	flags := stdlog.Ldate | stdlog.Lmicroseconds | stdlog.Llongfile | stdlog.LUTC
+	out := string(appendheader(nil, now, "/a/b/c/d.go", 23, flags))
+	if ref := "2009/01/23 01:23:23.123123 /a/b/c/d.go:23: "; out != ref {
+		t.Errorf("expected %q, got %q", ref, out)
+	}
+	out = string(appendheader(nil, now, "/a/b/c/d.go", 23, stdlog.Lshortfile))
+	if ref := "d.go:23: "; out != ref {
+		t.Errorf("expected %q, got %q", ref, out)
+	}
+}
+
+func TestLoggerClose(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	setts := map[string]interface{}{
+		"log.level": "info", "log.file": logfile, "log.timeformat": "",
+		"log.async": true,
+	}
+	logger := SetLogger(nil, setts)
+	defer SetLogger(nil, Defaultsettings())
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("expected panic")
+			}
+		}()
+		Fatalf("fatal %v", 1)
+	}()
+	// Fatalf should sync before panic.
+	if data, _ := ioutil.ReadFile(logfile); string(data) != "[Fatal] fatal 1\n" {
+		t.Errorf("unexpected %q", data)
+	}
+
+	// replacing the logger should close the previous one.
+	SetLogger(nil, map[string]interface{}{"log.level": "info"})
+	logger.Infof("after close")
+	if err := logger.Sync(); err == nil {
+		t.Errorf("expected error")
+	}
+	if data, _ := ioutil.ReadFile(logfile); string(data) != "[Fatal] fatal 1\n" {
+		t.Errorf("unexpected %q", data)
+	}
+
+	SetLogger(nil, setts)
+	Infof("hello")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+	ref := "[Fatal] fatal 1\n[Infom] hello\n"
+	if data, _ := ioutil.ReadFile(logfile); string(data) != ref {
+		t.Errorf("expected %q, got %q", ref, data)
+	}
+}
+
+func TestReconfigureRace(t *testing.T) {
+	setts := map[string]interface{}{"log.level": "info"}
+	logger, err := New(ioutil.Discard, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	var wg sync.WaitGroup
+	donech := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := With("writer", i)
+			for {
+				select {
+				case <-donech:
+					return
+				default:
+				}
+				Infof("hello %v", i)
+				Debugw("debug", "i", i)
+				child.Warnf("child %v", i)
+			}
+		}(i)
+	}
+
+	levels := []string{"trace", "info", "error", "debug"}
+	for i := 0; i < 200; i++ {
+		logger.SetLogLevel(levels[i%len(levels)])
+		logger.SetLogcolor("warn", []string{"red", "bold"})
+		logger.SetLogprefix(i%2 == 0)
+		logger.SetLogprefix("<%v>")
+		logger.SetTimeFormat(time.RFC3339)
+		logger.SetLogFlags(stdlog.Lshortfile)
+		if i%50 == 0 {
+			logger, _ = New(ioutil.Discard, setts)
+			SetLogger(logger, nil)
+		}
+	}
+	close(donech)
+	wg.Wait()
+}
+
+func TestConfigure(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, map[string]interface{}{"log.timeformat": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	setts := Defaultsettings()
+	setts["log.level"] = "loud"
+	setts["log.flags"] = "ldate,lfoo"
+	setts["log.file.maxsize"] = "10XB"
+	setts["log.colorinfo"] = "purple"
+	setts["log.verbosity"] = 2
+	setts["app.name"] = "ignored"
+	err = Configure(setts)
+	cerr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("unexpected %v", err)
+	} else if len(cerr.Errs) != 5 {
+		t.Errorf("unexpected %v", cerr.Errs)
+	}
+	keys := []string{
+		"log.colorinfo", "log.file.maxsize", "log.flags", "log.level",
+		"log.verbosity",
+	}
+	for i, key := range keys {
+		if !strings.Contains(cerr.Errs[i].Error(), key) {
+			t.Errorf("expected %q in %v", key, cerr.Errs[i])
+		}
+	}
+
+	// default logger is left unchanged.
+	Infof("hello")
+	if s := buf.String(); s != "[Infom] hello\n" {
+		t.Errorf("unexpected %q", s)
+	}
+	if err := Configure(Defaultsettings()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigureNil(t *testing.T) {
+	var buf bytes.Buffer
+	setts := map[string]interface{}{
+		"log.format": nil, "log.levelname": nil, "log.timeformat": nil,
+		"log.file": nil,
+	}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Infof("hello")
+	if s := buf.String(); s != "[Infom] hello\n" {
+		t.Errorf("unexpected %q", s)
+	}
+
+	// null values, as decoded from JSON, are treated as empty.
+	filename := filepath.Join(t.TempDir(), "app.json")
+	data := `{"log": {"format": null, "timeformat": null, "file": null}}`
+	if err := os.WriteFile(filename, []byte(data), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if setts, err := SettingsFromFile(filename); err != nil {
+		t.Fatal(err)
+	} else if setts["log.file"] != nil {
+		t.Errorf("unexpected %v", setts["log.file"])
+	} else if logger, err := New(nil, setts); err != nil {
+		t.Error(err)
+	} else {
+		logger.Close()
+	}
+	if _, err := New(nil, map[string]interface{}{"log.level": nil}); err == nil {
+		t.Errorf("expected error")
+	}
 }
@@ -0,0 +1,356 @@
+package log
+
+import "fmt"
+import "sort"
+import "sync"
+import "strings"
+import "sync/atomic"
+
+// registry of named loggers, name -> *namedLogger.
+var registry sync.Map
+
+// levelrule set level for loggers named prefix, or named prefix
+// followed by a "." and more components.
+type levelrule struct {
+	prefix string
+	level  LogLevel
+}
+
+// Named return a component logger, tagging every record with name.
+// Names are dot separated, like "storage.wal", and their level can
+// be set per prefix using "log.levels", say "storage=debug,
+// storage.wal=trace", loggers not matching any prefix log at
+// "log.level". Named loggers follow the default logger, hence they
+// can be created once, say as package variables, and continue to work
+// when default logger is re-configured. Calling Named with same name
+// returns the same logger. Refer Loggers() for the list of named
+// loggers.
+func Named(name string) Logger {
+	if n, ok := registry.Load(name); ok {
+		return n.(*namedLogger)
+	}
+	n, _ := registry.LoadOrStore(name, &namedLogger{name: name})
+	return n.(*namedLogger)
+}
+
+// Loggers return all named loggers created using Named() and their
+// effective log level.
+func Loggers() map[string]LogLevel {
+	levels := map[string]LogLevel{}
+	registry.Range(func(key, value interface{}) bool {
+		levels[key.(string)] = value.(*namedLogger).level()
+		return true
+	})
+	return levels
+}
+
+// Named for defaultLogger, return a child logger tagging every record
+// with name, names of nested child loggers are joined with ".".
+// Unlike Named(), the child logger is bound to l.
+func (l *defaultLogger) Named(name string) Logger {
+	child := *l
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	child.name = name
+	return &child
+}
+
+// effectivelevel of l, from "log.levels" if l is named, else from
+// "log.level".
+func (l *defaultLogger) effectivelevel() LogLevel {
+	if l.name != "" {
+		if level, ok := matchlevel(l.config().levels, l.name); ok {
+			return level
+		}
+	}
+	return l.loglevel()
+}
+
+// setlevelrule add or replace rule for prefix.
+func (l *defaultLogger) setlevelrule(prefix string, level LogLevel) {
+	l.update(func(cfg *logconfig) {
+		rules := []levelrule{{prefix: prefix, level: level}}
+		for _, rule := range cfg.levels {
+			if rule.prefix != prefix {
+				rules = append(rules, rule)
+			}
+		}
+		cfg.levels = sortrules(rules)
+	})
+}
+
+// namedLogger resolve the default logger on every call, such that it
+// follows SetLogger() and Configure().
+type namedLogger struct {
+	name   string
+	fields []Field
+	cache  atomic.Value // namedcache
+}
+
+// namedcache child logger, derived from the default logger parent.
+type namedcache struct {
+	parent Logger
+	child  Logger
+}
+
+func (n *namedLogger) logger() Logger {
+	parent := getlog()
+	if c, ok := n.cache.Load().(namedcache); ok && c.parent == parent {
+		return c.child
+	}
+	var child Logger
+	if l, ok := parent.(*defaultLogger); ok {
+		child = &defaultLogger{
+			logstate: l.logstate, name: n.name,
+			fields: joinfields(l.fields, n.fields),
+		}
+	} else { // custom logger, tag records with a field instead.
+		keyvals := []interface{}{"logger", n.name}
+		for _, field := range n.fields {
+			keyvals = append(keyvals, field.Key, field.Value)
+		}
+		child = parent.With(keyvals...)
+	}
+	n.cache.Store(namedcache{parent: parent, child: child})
+	return child
+}
+
+func (n *namedLogger) level() LogLevel {
+	logger := n.logger()
+	if l, ok := logger.(*defaultLogger); ok {
+		return l.effectivelevel()
+	}
+	for level := LogLevelTrace; level > LogLevelIgnore; level-- {
+		if logger.Enabled(level) {
+			return level
+		}
+	}
+	return LogLevelIgnore
+}
+
+// Named return a component logger named n's name followed by "." and
+// name, refer Named().
+func (n *namedLogger) Named(name string) Logger {
+	return Named(n.name + "." + name)
+}
+
+// SetLogLevel for namedLogger, set level for this logger and loggers
+// named with its name as prefix, same as adding a "log.levels" rule.
+func (n *namedLogger) SetLogLevel(level string) {
+	ll, err := ParseLevel(level)
+	if err != nil {
+		panic(err)
+	}
+	if l, ok := getlog().(*defaultLogger); ok {
+		l.setlevelrule(n.name, ll)
+		return
+	}
+	n.logger().SetLogLevel(level)
+}
+
+// SetLogFlags for namedLogger, applies to the default logger.
+func (n *namedLogger) SetLogFlags(flags int) {
+	n.logger().SetLogFlags(flags)
+}
+
+// SetTimeFormat for namedLogger, applies to the default logger.
+func (n *namedLogger) SetTimeFormat(format string) {
+	n.logger().SetTimeFormat(format)
+}
+
+// SetLogprefix for namedLogger, applies to the default logger.
+func (n *namedLogger) SetLogprefix(prefix interface{}) {
+	n.logger().SetLogprefix(prefix)
+}
+
+// SetLogcolor for namedLogger, applies to the default logger.
+func (n *namedLogger) SetLogcolor(level string, attrs []string) {
+	n.logger().SetLogcolor(level, attrs)
+}
+
+// Fatalf for namedLogger
+func (n *namedLogger) Fatalf(format string, v ...interface{}) {
+	n.logger().Printlf(LogLevelFatal, format, v...)
+}
+
+// Errorf for namedLogger
+func (n *namedLogger) Errorf(format string, v ...interface{}) {
+	n.logger().Printlf(LogLevelError, format, v...)
+}
+
+// Warnf for namedLogger
+func (n *namedLogger) Warnf(format string, v ...interface{}) {
+	n.logger().Printlf(LogLevelWarn, format, v...)
+}
+
+// Infof for namedLogger
+func (n *namedLogger) Infof(format string, v ...interface{}) {
+	n.logger().Printlf(LogLevelInfo, format, v...)
+}
+
+// Verbosef for namedLogger
+func (n *namedLogger) Verbosef(format string, v ...interface{}) {
+	n.logger().Printlf(LogLevelVerbose, format, v...)
+}
+
+// Debugf for namedLogger
+func (n *namedLogger) Debugf(format string, v ...interface{}) {
+	n.logger().Printlf(LogLevelDebug, format, v...)
+}
+
+// Tracef for namedLogger
+func (n *namedLogger) Tracef(format string, v ...interface{}) {
+	n.logger().Printlf(LogLevelTrace, format, v...)
+}
+
+// Printlf for namedLogger
+func (n *namedLogger) Printlf(level LogLevel, format string, v ...interface{}) {
+	n.logger().Printlf(level, format, v...)
+}
+
+// With for namedLogger, the child logger continues to follow the
+// default logger.
+func (n *namedLogger) With(keyvals ...interface{}) Logger {
+	fields := make([]Field, 0, len(n.fields)+(len(keyvals)+1)/2)
+	fields = append(fields, n.fields...)
+	return &namedLogger{name: n.name, fields: kv2fields(fields, keyvals)}
+}
+
+// Fatalw for namedLogger
+func (n *namedLogger) Fatalw(msg string, keyvals ...interface{}) {
+	n.logger().Printlw(LogLevelFatal, msg, keyvals...)
+}
+
+// Errorw for namedLogger
+func (n *namedLogger) Errorw(msg string, keyvals ...interface{}) {
+	n.logger().Printlw(LogLevelError, msg, keyvals...)
+}
+
+// Warnw for namedLogger
+func (n *namedLogger) Warnw(msg string, keyvals ...interface{}) {
+	n.logger().Printlw(LogLevelWarn, msg, keyvals...)
+}
+
+// Infow for namedLogger
+func (n *namedLogger) Infow(msg string, keyvals ...interface{}) {
+	n.logger().Printlw(LogLevelInfo, msg, keyvals...)
+}
+
+// Verbosew for namedLogger
+func (n *namedLogger) Verbosew(msg string, keyvals ...interface{}) {
+	n.logger().Printlw(LogLevelVerbose, msg, keyvals...)
+}
+
+// Debugw for namedLogger
+func (n *namedLogger) Debugw(msg string, keyvals ...interface{}) {
+	n.logger().Printlw(LogLevelDebug, msg, keyvals...)
+}
+
+// Tracew for namedLogger
+func (n *namedLogger) Tracew(msg string, keyvals ...interface{}) {
+	n.logger().Printlw(LogLevelTrace, msg, keyvals...)
+}
+
+// Printlw for namedLogger
+func (n *namedLogger) Printlw(level LogLevel, msg string, keyvals ...interface{}) {
+	n.logger().Printlw(level, msg, keyvals...)
+}
+
+// Enabled for namedLogger.
+func (n *namedLogger) Enabled(level LogLevel) bool {
+	return n.logger().Enabled(level)
+}
+
+// Sync for namedLogger, sync the default logger.
+func (n *namedLogger) Sync() error {
+	return n.logger().Sync()
+}
+
+// Close for namedLogger is a no-op, named loggers share the default
+// logger's output, which is closed by SetLogger() or Shutdown().
+func (n *namedLogger) Close() error {
+	return nil
+}
+
+// levelrules parse "log.levels", comma separated list of prefix=level,
+// and "log.levels.<prefix>" parameters from setts. Rules are sorted
+// with longer prefix first.
+func levelrules(setts map[string]interface{}) ([]levelrule, error) {
+	rules := []levelrule{}
+	items, err := settingcsv(setts, "log.levels")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		prefix, level, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid level rule %q", item)
+		}
+		rule, err := newlevelrule(prefix, level)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	for key, value := range setts {
+		if !strings.HasPrefix(key, "log.levels.") {
+			continue
+		}
+		level, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid type: parameter %q has %T", key, value)
+		}
+		rule, err := newlevelrule(strings.TrimPrefix(key, "log.levels."), level)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return sortrules(rules), nil
+}
+
+func newlevelrule(prefix, level string) (levelrule, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return levelrule{}, fmt.Errorf("missing logger name in level rule")
+	}
+	ll, err := ParseLevel(strings.TrimSpace(level))
+	if err != nil {
+		return levelrule{}, err
+	}
+	return levelrule{prefix: prefix, level: ll}, nil
+}
+
+func sortrules(rules []levelrule) []levelrule {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].prefix) != len(rules[j].prefix) {
+			return len(rules[i].prefix) > len(rules[j].prefix)
+		}
+		return rules[i].prefix < rules[j].prefix
+	})
+	return rules
+}
+
+// matchlevel return level of the longest rule matching name.
+func matchlevel(rules []levelrule, name string) (LogLevel, bool) {
+	for _, rule := range rules {
+		if !strings.HasPrefix(name, rule.prefix) {
+			continue
+		} else if len(name) == len(rule.prefix) || name[len(rule.prefix)] == '.' {
+			return rule.level, true
+		}
+	}
+	return 0, false
+}
+
+// rules2string is the inverse of levelrules, rules are sorted by
+// prefix.
+func rules2string(rules []levelrule) string {
+	ss := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		ss = append(ss, rule.prefix+"="+rule.level.Name())
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
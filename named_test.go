@@ -0,0 +1,112 @@
+package log
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestNamed(t *testing.T) {
+	wal, store := Named("storage.wal"), Named("storage")
+	seg, httplog := Named("storage.wal.segment"), Named("http")
+	if Named("storage.wal") != wal {
+		t.Errorf("expected same logger for same name")
+	}
+
+	var buf bytes.Buffer
+	setts := map[string]interface{}{
+		"log.level": "info", "log.timeformat": "",
+		"log.levels": "storage=debug", "log.levels.storage.wal": "trace",
+	}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	wal.Tracef("wal")
+	seg.Tracef("segment")
+	store.Tracef("hidden")
+	store.Debugf("storage")
+	httplog.Debugf("hidden")
+	httplog.With("method", "GET").Infof("http")
+	Debugf("hidden")
+	ref := "[Trace] storage.wal: wal\n" +
+		"[Trace] storage.wal.segment: segment\n" +
+		"[Debug] storage: storage\n" +
+		"[Infom] http: http method=GET\n"
+	if s := buf.String(); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+
+	levels := Loggers()
+	refs := map[string]LogLevel{
+		"storage.wal": LogLevelTrace, "storage.wal.segment": LogLevelTrace,
+		"storage": LogLevelDebug, "http": LogLevelInfo,
+	}
+	for name, ref := range refs {
+		if levels[name] != ref {
+			t.Errorf("%v expected %v, got %v", name, ref, levels[name])
+		}
+	}
+
+	// named loggers follow the default logger.
+	buf.Reset()
+	setts["log.format"], setts["log.levels"] = "json", ""
+	delete(setts, "log.levels.storage.wal")
+	if logger, err = New(&buf, setts); err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	wal.Tracef("hidden")
+	wal.Infof("json")
+	if s := buf.String(); !strings.Contains(s, `"logger":"storage.wal","msg":"json"`) {
+		t.Errorf("unexpected %q", s)
+	}
+
+	// SetLogLevel on named logger adds a rule.
+	wal.SetLogLevel("debug")
+	if !seg.Enabled(LogLevelDebug) || store.Enabled(LogLevelDebug) {
+		t.Errorf("unexpected levels %v", Loggers())
+	} else if s := Settings()["log.levels"]; s != "storage.wal=debug" {
+		t.Errorf("unexpected %v", s)
+	}
+}
+
+func TestLevelRules(t *testing.T) {
+	setts := map[string]interface{}{
+		"log.levels":     []interface{}{"a=debug", "a.b.c=error"},
+		"log.levels.a.b": "trace",
+	}
+	rules, err := levelrules(setts)
+	if err != nil {
+		t.Fatal(err)
+	} else if s := rules2string(rules); s != "a.b.c=error,a.b=trace,a=debug" {
+		t.Errorf("unexpected %v", s)
+	}
+	testcases := []struct {
+		name  string
+		level LogLevel
+		ok    bool
+	}{
+		{"a", LogLevelDebug, true},
+		{"ab", 0, false},
+		{"a.x", LogLevelDebug, true},
+		{"a.b", LogLevelTrace, true},
+		{"a.b.c.d", LogLevelError, true},
+		{"b", 0, false},
+	}
+	for _, tc := range testcases {
+		level, ok := matchlevel(rules, tc.name)
+		if level != tc.level || ok != tc.ok {
+			t.Errorf("%v expected %v, got %v", tc.name, tc.level, level)
+		}
+	}
+
+	setts = map[string]interface{}{
+		"log.levels": "a=loud,b", "log.levels.c": "error", "log.levels.d": 1,
+	}
+	err = validate(setts)
+	if cerr, ok := err.(*ConfigError); !ok || len(cerr.Errs) != 2 {
+		t.Errorf("unexpected %v", err)
+	}
+}
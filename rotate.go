@@ -0,0 +1,570 @@
+package log
+
+import "io"
+import "os"
+import "fmt"
+import "sort"
+import "time"
+import "sync"
+import "os/signal"
+import "strings"
+import "path/filepath"
+import "compress/gzip"
+
+const backuptimeformat = "2006-01-02T15-04-05.000"
+
+// rotatingFile is an io.Writer for "log.file". If file name is a
+// strftime style pattern, like "app-%Y%m%d-%H.log", writes switch to
+// a new file every time the wall-clock crosses the configured interval.
+// If maxsize is configured, the current file is renamed to a
+// timestamped backup once its size reaches maxsize, and writes
+// continue on a freshly created file. Backups beyond maxbackups, or
+// older than maxage, or beyond maxtotal size, are removed after every
+// rotation. If compress is true backups are gzip compressed. Both
+// compression and cleanup happen in the background.
+type rotatingFile struct {
+	mu         sync.Mutex
+	pattern    string // strftime style pattern, else empty.
+	interval   string // "hourly" or "daily", for pattern.
+	loc        *time.Location
+	symlink    string
+	maxsize    int64
+	maxbackups int
+	maxage     time.Duration
+	maxtotal   int64
+	compress   bool
+	millch     chan struct{} // kick background compression and cleanup.
+	milldone   chan struct{}
+	reopensig  os.Signal
+	sigch      chan os.Signal
+
+	filename string
+	boundary time.Time // switch to a new file at boundary, for pattern.
+	fd       *os.File
+	size     int64
+	closed   bool
+}
+
+// newRotatingFile for filename, reading rotation parameters,
+// "log.file.maxsize", "log.file.maxbackups", "log.file.maxage",
+// "log.file.maxtotalsize", "log.file.compress", "log.file.interval",
+// "log.file.timezone", "log.file.symlink" and "log.file.reopensignal"
+// from setts.
+func newRotatingFile(
+	filename string, setts map[string]interface{}) (*rotatingFile, error) {
+
+	f := &rotatingFile{filename: filename, loc: time.Local}
+
+	var err error
+	if f.maxsize, err = settingsize(setts, "log.file.maxsize"); err != nil {
+		return nil, err
+	}
+	maxbackups, err := settingsize(setts, "log.file.maxbackups")
+	if err != nil {
+		return nil, err
+	}
+	f.maxbackups = int(maxbackups)
+	if f.maxage, err = settingduration(setts, "log.file.maxage"); err != nil {
+		return nil, err
+	}
+	f.maxtotal, err = settingsize(setts, "log.file.maxtotalsize")
+	if err != nil {
+		return nil, err
+	}
+	if f.compress, err = settingbool(setts, "log.file.compress"); err != nil {
+		return nil, err
+	}
+	reopensignal, _ := setts["log.file.reopensignal"].(string)
+	if reopensignal != "" {
+		if f.reopensig, err = string2signal(reopensignal); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.Contains(filename, "%") {
+		f.pattern = filename
+		if _, err := strftime(f.pattern, time.Now()); err != nil {
+			return nil, err
+		}
+		interval, _ := setts["log.file.interval"].(string)
+		if f.interval, err = string2interval(interval, f.pattern); err != nil {
+			return nil, err
+		}
+		if tz, _ := setts["log.file.timezone"].(string); tz != "" {
+			if f.loc, err = time.LoadLocation(tz); err != nil {
+				return nil, err
+			}
+		}
+		if symlink, _ := setts["log.file.symlink"].(string); symlink != "" {
+			f.symlink = symlink
+			if !filepath.IsAbs(symlink) {
+				dir, _ := filepath.Split(filename)
+				f.symlink = filepath.Join(dir, symlink)
+			}
+		}
+		if err := f.switchfile(time.Now()); err != nil {
+			return nil, err
+		}
+	} else if f.fd, f.size, err = f.open(filename); err != nil {
+		return nil, err
+	}
+
+	if f.compress || f.maxbackups > 0 || f.maxage > 0 || f.maxtotal > 0 {
+		f.millch, f.milldone = make(chan struct{}, 1), make(chan struct{})
+		go f.mill()
+		f.kick() // compress and prune backups left by previous runs.
+	}
+	if f.reopensig != nil {
+		f.sigch = make(chan os.Signal, 1)
+		signal.Notify(f.sigch, f.reopensig)
+		go f.reopenon(f.sigch)
+	}
+	return f, nil
+}
+
+// Reopen the current log file by its name, useful when the file is
+// renamed by external tools like logrotate. The new file is opened
+// before closing the old one, and writes wait for the swap, hence no
+// log record is lost.
+func (f *rotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	fd, size, err := f.open(f.filename)
+	if err != nil {
+		return err // continue writing to the old file.
+	}
+	oldfd := f.fd
+	f.fd, f.size = fd, size
+	return oldfd.Close()
+}
+
+func (f *rotatingFile) reopenon(sigch chan os.Signal) {
+	for range sigch {
+		f.Reopen()
+	}
+}
+
+// name return the configured pattern or filename.
+func (f *rotatingFile) name() string {
+	if f.pattern != "" {
+		return f.pattern
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.filename
+}
+
+// Sync commit the current log file to stable storage.
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.fd.Sync()
+}
+
+// Close sync and close the current log file, and stop background
+// routines. Writes after Close fail with os.ErrClosed.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return os.ErrClosed
+	}
+	f.closed = true
+	err := f.fd.Sync()
+	if cerr := f.fd.Close(); err == nil {
+		err = cerr
+	}
+	if f.sigch != nil {
+		signal.Stop(f.sigch)
+		close(f.sigch)
+	}
+	if f.millch != nil {
+		close(f.millch)
+	}
+	f.mu.Unlock()
+
+	if f.milldone != nil {
+		<-f.milldone // wait for in-flight compression and cleanup.
+	}
+	return err
+}
+
+// Write p as a whole into the current log file, rotating the file
+// before the write if p would cross maxsize or the clock has crossed
+// the interval boundary. Log records are never split across files.
+// If rotation fails, p is written to the current file and the
+// rotation error is returned.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	var rerr error
+	if f.pattern != "" {
+		if now := time.Now(); !now.Before(f.boundary) {
+			rerr = f.switchfile(now)
+		}
+	}
+	if rerr == nil && f.maxsize > 0 && f.size > 0 &&
+		f.size+int64(len(p)) > f.maxsize {
+
+		rerr = f.rotate()
+	}
+	n, err := f.fd.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rerr
+	}
+	return n, err
+}
+
+// open log file filename, return its descriptor and current size.
+func (f *rotatingFile) open(filename string) (*os.File, int64, error) {
+	if f.pattern != "" {
+		if dir, _ := filepath.Split(filename); dir != "" {
+			if err := os.MkdirAll(dir, 0770); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	fd, err := openlogfile(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, 0, err
+	}
+	return fd, info.Size(), nil
+}
+
+// switchfile to the file name for now, shall be called with f.mu
+// locked. If the new file cannot be opened, writes continue on the
+// current file.
+func (f *rotatingFile) switchfile(now time.Time) error {
+	now = now.In(f.loc)
+	filename, _ := strftime(f.pattern, now)
+	if f.fd == nil || filename != f.filename {
+		fd, size, err := f.open(filename)
+		if err != nil {
+			return err
+		}
+		if f.fd != nil {
+			f.fd.Close()
+		}
+		f.filename, f.fd, f.size = filename, fd, size
+		f.relink()
+		f.kick()
+	}
+	f.boundary = nextboundary(now, f.interval)
+	return nil
+}
+
+// relink point symlink to the current file, by atomically renaming
+// a temporary link over it.
+func (f *rotatingFile) relink() {
+	if f.symlink == "" {
+		return
+	}
+	target, err := filepath.Abs(f.filename)
+	if err != nil {
+		return
+	}
+	linkdir, _ := filepath.Split(f.symlink)
+	if dir, base := filepath.Split(f.filename); dir == linkdir {
+		target = base
+	}
+	tmpname := f.symlink + ".tmp"
+	os.Remove(tmpname)
+	if err := os.Symlink(target, tmpname); err == nil {
+		os.Rename(tmpname, f.symlink)
+	}
+}
+
+// rotate shall be called with f.mu locked. The current file is
+// renamed while still open and swapped only after the new file is
+// opened, such that on failure writes continue on the current file.
+func (f *rotatingFile) rotate() error {
+	backup := f.backupname(time.Now())
+	if err := os.Rename(f.filename, backup); err != nil {
+		return err
+	}
+	fd, size, err := f.open(f.filename)
+	if err != nil {
+		os.Rename(backup, f.filename)
+		return err
+	}
+	oldfd := f.fd
+	f.fd, f.size = fd, size
+	err = oldfd.Close()
+	f.kick()
+	return err
+}
+
+// backupname for log file "dir/name.ext" is of the form,
+// "dir/name-<timestamp>.ext".
+func (f *rotatingFile) backupname(t time.Time) string {
+	dir, base, ext := splitfilename(f.filename)
+	stamp := t.UTC().Format(backuptimeformat)
+	name := filepath.Join(dir, base+"-"+stamp+ext)
+	for i := 1; ; i++ { // more than one rotation within a millisecond.
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = filepath.Join(dir, fmt.Sprintf("%v-%v.%v%v", base, stamp, i, ext))
+	}
+}
+
+// backups return the list of backup files, compressed and otherwise,
+// newest first. For pattern, every file matching the pattern, other
+// than the current file, is treated as a backup.
+func (f *rotatingFile) backups(current string) []backupinfo {
+	var matches []string
+	if f.pattern != "" {
+		glob := pattern2glob(f.pattern)
+		matches, _ = filepath.Glob(glob)
+		gzmatches, _ := filepath.Glob(glob + ".gz")
+		matches = append(matches, gzmatches...)
+	} else {
+		dir, base, ext := splitfilename(current)
+		globs, _ := filepath.Glob(filepath.Join(dir, base+"-*"+ext))
+		gzglobs, _ := filepath.Glob(filepath.Join(dir, base+"-*"+ext+".gz"))
+		for _, match := range append(globs, gzglobs...) {
+			name := strings.TrimSuffix(filepath.Base(match), ".gz")
+			if isbackup(name, base, ext) {
+				matches = append(matches, match)
+			}
+		}
+	}
+
+	infos := []backupinfo{}
+	for _, match := range matches {
+		if match == filepath.Clean(current) {
+			continue
+		}
+		info, err := os.Lstat(match)
+		if err == nil && info.Mode().IsRegular() {
+			infos = append(infos, backupinfo{match, info})
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	return infos
+}
+
+// kick the mill without blocking the caller, if mill is already due
+// this is a no-op.
+func (f *rotatingFile) kick() {
+	select {
+	case f.millch <- struct{}{}:
+	default:
+	}
+}
+
+// mill compress and prune backups in the background, so that writers
+// never wait on them.
+func (f *rotatingFile) mill() {
+	defer close(f.milldone)
+
+	f.mu.Lock()
+	current := f.filename
+	f.mu.Unlock()
+	// remove half written archives left by a crash.
+	for _, backup := range f.backups(current) {
+		tmpnames, _ := filepath.Glob(backup.path + ".gz.tmp")
+		for _, tmpname := range tmpnames {
+			os.Remove(tmpname)
+		}
+	}
+
+	for range f.millch {
+		f.mu.Lock()
+		current := f.filename
+		f.mu.Unlock()
+
+		if f.compress {
+			for _, backup := range f.backups(current) {
+				if !strings.HasSuffix(backup.path, ".gz") {
+					compressfile(backup.path, backup.FileInfo)
+				}
+			}
+		}
+		f.cleanup(current)
+	}
+}
+
+// cleanup remove backups beyond maxbackups, older than maxage and
+// beyond maxtotal size, counting from the newest backup.
+func (f *rotatingFile) cleanup(current string) {
+	now, total := time.Now(), int64(0)
+	for i, backup := range f.backups(current) {
+		total += backup.Size()
+		if f.maxbackups > 0 && i >= f.maxbackups {
+			os.Remove(backup.path)
+		} else if f.maxage > 0 && now.Sub(backup.ModTime()) > f.maxage {
+			os.Remove(backup.path)
+		} else if f.maxtotal > 0 && total > f.maxtotal {
+			os.Remove(backup.path)
+		}
+	}
+}
+
+// compressfile into "<name>.gz", retaining its modification time. The
+// archive is written to "<name>.gz.tmp" and renamed only after it is
+// complete and synced, such that a crash will never leave a partial
+// archive that looks like a complete backup.
+func compressfile(name string, info os.FileInfo) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpname := name + ".gz.tmp"
+	flags, perm := os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm()
+	dst, err := os.OpenFile(tmpname, flags, perm)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(tmpname, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmpname, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// backupinfo remember the path of a backup file along with its info.
+type backupinfo struct {
+	path string
+	os.FileInfo
+}
+
+// isbackup check whether name is "<base>-<timestamp>[.n]<ext>".
+func isbackup(name, base, ext string) bool {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, base+"-"), ext)
+	if len(stamp) < len(backuptimeformat) {
+		return false
+	}
+	_, err := time.Parse(backuptimeformat, stamp[:len(backuptimeformat)])
+	return err == nil
+}
+
+func splitfilename(filename string) (dir, base, ext string) {
+	dir, base = filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext), ext
+}
+
+// strftime supports the following conversions, %Y year, %y two digit
+// year, %m month, %d day of month, %j day of year, %H hour, %M minute,
+// %S second, %% a literal '%'.
+func strftime(pattern string, t time.Time) (string, error) {
+	out := make([]byte, 0, len(pattern)+16)
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			out = append(out, pattern[i])
+			continue
+		} else if i++; i == len(pattern) {
+			return "", fmt.Errorf("incomplete conversion in %q", pattern)
+		}
+		switch pattern[i] {
+		case 'Y':
+			out = appendint(out, t.Year(), 4)
+		case 'y':
+			out = appendint(out, t.Year()%100, 2)
+		case 'm':
+			out = appendint(out, int(t.Month()), 2)
+		case 'd':
+			out = appendint(out, t.Day(), 2)
+		case 'j':
+			out = appendint(out, t.YearDay(), 3)
+		case 'H':
+			out = appendint(out, t.Hour(), 2)
+		case 'M':
+			out = appendint(out, t.Minute(), 2)
+		case 'S':
+			out = appendint(out, t.Second(), 2)
+		case '%':
+			out = append(out, '%')
+		default:
+			fmsg := "unsupported conversion %%%c in %q"
+			return "", fmt.Errorf(fmsg, pattern[i], pattern)
+		}
+	}
+	return string(out), nil
+}
+
+// pattern2glob replace every conversion in pattern with '*'.
+func pattern2glob(pattern string) string {
+	out := make([]byte, 0, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '%' && i+1 < len(pattern) {
+			if i++; pattern[i] == '%' {
+				out = append(out, '%')
+			} else if len(out) == 0 || out[len(out)-1] != '*' {
+				out = append(out, '*')
+			}
+			continue
+		}
+		out = append(out, pattern[i])
+	}
+	return string(out)
+}
+
+// string2interval validate interval, if empty, interval is derived
+// from the finest conversion in pattern.
+func string2interval(interval, pattern string) (string, error) {
+	switch strings.ToLower(interval) {
+	case "hourly":
+		return "hourly", nil
+	case "daily":
+		return "daily", nil
+	case "":
+		if strings.Contains(pattern, "%H") {
+			return "hourly", nil
+		}
+		return "daily", nil
+	}
+	return "", fmt.Errorf("invalid log.file.interval %q", interval)
+}
+
+// nextboundary after now for interval, in now's location.
+func nextboundary(now time.Time, interval string) time.Time {
+	y, m, d := now.Date()
+	if interval == "hourly" {
+		return time.Date(y, m, d, now.Hour()+1, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
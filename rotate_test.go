@@ -0,0 +1,338 @@
+package log
+
+import "io"
+import "os"
+import "bytes"
+import "fmt"
+import "sync"
+import "time"
+import "strings"
+import "testing"
+import "path/filepath"
+import "compress/gzip"
+
+func TestRotateSize(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	setts := map[string]interface{}{
+		"log.level": "info", "log.file": logfile, "log.timeformat": "",
+		"log.file.maxsize": "1KB",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Infof("writer %v line %v", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "app*.log"))
+	if len(matches) < 10 {
+		t.Fatalf("expected rotated files, got %v", matches)
+	}
+	lines := 0
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(data) > 1024 {
+			t.Errorf("%v exceeds maxsize, %v", match, len(data))
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var i, j int
+			frmt := "[Infom] writer %d line %d"
+			if _, err := fmt.Sscanf(line, frmt, &i, &j); err != nil {
+				t.Errorf("corrupted line %q in %v", line, match)
+			}
+			lines++
+		}
+	}
+	if lines != 800 {
+		t.Errorf("expected %v, got %v", 800, lines)
+	}
+}
+
+func TestRotateRetention(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	past := time.Now().Add(-48 * time.Hour)
+	old := filepath.Join(dir, "app-"+past.UTC().Format(backuptimeformat)+".log")
+	if err := os.WriteFile(old, []byte("old\n"), 0660); err != nil {
+		t.Fatal(err)
+	} else if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "app-other.log")
+	if err := os.WriteFile(other, []byte("other\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	setts := map[string]interface{}{
+		"log.file.maxsize": 10, "log.file.maxbackups": 2,
+		"log.file.maxage": "24h",
+	}
+	f, err := newRotatingFile(logfile, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 5; i++ {
+		f.Write([]byte("0123456789\n"))
+	}
+	waitfor(t, func() bool {
+		_, err := os.Stat(old)
+		return len(f.backups(logfile)) == 2 && os.IsNotExist(err)
+	})
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unexpected %v", err)
+	}
+}
+
+func TestSettingsize(t *testing.T) {
+	setts := map[string]interface{}{
+		"a": "10", "b": "2 KB", "c": "1mb", "d": 3, "e": 4.0, "f": "x",
+		"g": true,
+	}
+	refs := map[string]int64{
+		"a": 10, "b": 2048, "c": 1 << 20, "d": 3, "e": 4, "missing": 0,
+	}
+	for key, ref := range refs {
+		if n, err := settingsize(setts, key); err != nil {
+			t.Error(err)
+		} else if n != ref {
+			t.Errorf("%v expected %v, got %v", key, ref, n)
+		}
+	}
+	if _, err := settingsize(setts, "f"); err == nil {
+		t.Errorf("expected error")
+	} else if _, err := settingsize(setts, "g"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestRotateInterval(t *testing.T) {
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "app-%Y%m%d-%H.log")
+	setts := map[string]interface{}{
+		"log.file.timezone": "UTC", "log.file.symlink": "current",
+	}
+	f, err := newRotatingFile(pattern, setts)
+	if err != nil {
+		t.Fatal(err)
+	} else if f.interval != "hourly" {
+		t.Errorf("unexpected interval %v", f.interval)
+	}
+	defer f.Close()
+	f.Write([]byte("first\n"))
+
+	// move the clock past the boundary.
+	f.mu.Lock()
+	first := f.filename
+	f.switchfile(time.Now().Add(time.Hour))
+	second := f.filename
+	f.boundary = time.Now().Add(time.Hour)
+	f.mu.Unlock()
+	f.Write([]byte("second\n"))
+
+	if first == second {
+		t.Fatalf("expected switch to new file, %v", first)
+	}
+	ref := filepath.Join(dir, "app-"+
+		time.Now().Add(time.Hour).UTC().Format("20060102-15")+".log")
+	if second != ref {
+		t.Errorf("expected %v, got %v", ref, second)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "first\n" {
+		t.Errorf("unexpected %q", data)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "current"))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "second\n" {
+		t.Errorf("unexpected %q", data)
+	}
+	if backups := f.backups(f.filename); len(backups) != 1 {
+		t.Errorf("unexpected %v", backups)
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	f, err := newRotatingFile(logfile, map[string]interface{}{"log.file.maxsize": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// rename fails, write continues on the current file.
+	f.Write([]byte("first\n"))
+	os.Remove(logfile)
+	if n, err := f.Write([]byte("second\n")); n != 7 || err == nil {
+		t.Errorf("unexpected %v %v", n, err)
+	} else if err := f.Sync(); err != nil {
+		t.Errorf("unexpected %v", err)
+	}
+
+	// new file for pattern cannot be opened.
+	pattern := filepath.Join(dir, "%Y%m%d%H", "app.log")
+	g, err := newRotatingFile(pattern, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	next := time.Now().Add(time.Hour)
+	blocker := filepath.Join(dir, next.Format("2006010215"))
+	if err := os.WriteFile(blocker, nil, 0660); err != nil {
+		t.Fatal(err)
+	}
+	g.mu.Lock()
+	first := g.filename
+	if err := g.switchfile(next); err == nil {
+		t.Errorf("expected error")
+	}
+	g.mu.Unlock()
+	if n, err := g.Write([]byte("kept\n")); n != 5 || err != nil {
+		t.Errorf("unexpected %v %v", n, err)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "kept\n" {
+		t.Errorf("unexpected %q", data)
+	}
+}
+
+func TestRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	// half written archive left by a crash.
+	stale := filepath.Join(dir, "app-"+
+		time.Now().UTC().Format(backuptimeformat)+".log")
+	if err := os.WriteFile(stale, []byte("stale\n"), 0660); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(stale+".gz.tmp", []byte("x"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	setts := map[string]interface{}{
+		"log.file.maxsize": 100, "log.file.compress": true,
+		"log.file.maxtotalsize": 400,
+	}
+	f, err := newRotatingFile(logfile, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	line := []byte(strings.Repeat("x", 99) + "\n")
+	for i := 0; i < 20; i++ {
+		f.Write(line)
+	}
+
+	waitfor(t, func() bool {
+		backups, total := f.backups(logfile), int64(0)
+		for _, backup := range backups {
+			if !strings.HasSuffix(backup.path, ".gz") {
+				return false
+			}
+			total += backup.Size()
+		}
+		tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+		return len(backups) > 0 && total <= 400 && len(tmps) == 0
+	})
+
+	backups := f.backups(logfile)
+	fd, err := os.Open(backups[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	gz, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(gz); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, line) {
+		t.Errorf("unexpected %q", data)
+	}
+}
+
+func waitfor(t *testing.T, cond func() bool) {
+	for i := 0; i < 500; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("condition not met")
+}
+
+func TestStrftime(t *testing.T) {
+	now := time.Date(2009, 1, 23, 1, 2, 3, 0, time.UTC)
+	s, err := strftime("a-%Y%m%d-%H%M%S-%y-%j-%%.log", now)
+	if err != nil {
+		t.Fatal(err)
+	} else if ref := "a-20090123-010203-09-023-%.log"; s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+	if _, err := strftime("a-%q", now); err == nil {
+		t.Errorf("expected error")
+	} else if _, err := strftime("a-%", now); err == nil {
+		t.Errorf("expected error")
+	}
+	if s := pattern2glob("a-%Y%m%d-%%.log"); s != "a-*-%.log" {
+		t.Errorf("unexpected %q", s)
+	}
+
+	loc := time.FixedZone("X", 5*3600)
+	now = time.Date(2009, 1, 23, 23, 30, 0, 0, loc)
+	ref := time.Date(2009, 1, 24, 0, 0, 0, 0, loc)
+	if b := nextboundary(now, "daily"); !b.Equal(ref) {
+		t.Errorf("expected %v, got %v", ref, b)
+	} else if b = nextboundary(now, "hourly"); !b.Equal(ref) {
+		t.Errorf("expected %v, got %v", ref, b)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	setts := map[string]interface{}{
+		"log.level": "info", "log.file": logfile, "log.timeformat": "",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	logger.Infof("before")
+	// logrotate with create mode.
+	if err := os.Rename(logfile, logfile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infof("renamed")
+	if err := Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infof("after")
+
+	data, _ := os.ReadFile(logfile + ".1")
+	if ref := "[Infom] before\n[Infom] renamed\n"; string(data) != ref {
+		t.Errorf("expected %q, got %q", ref, data)
+	}
+	if data, _ := os.ReadFile(logfile); string(data) != "[Infom] after\n" {
+		t.Errorf("unexpected %q", data)
+	}
+
+}
@@ -0,0 +1,277 @@
+package log
+
+import "os"
+import "fmt"
+import "bytes"
+import "strings"
+import "strconv"
+import "path/filepath"
+import "encoding/json"
+
+// SettingsFromFile load settings from filename on top of
+// Defaultsettings(). Files with ".json" extension are parsed as JSON,
+// files with ".toml", ".ini", ".conf" or ".cfg" extension are parsed
+// as a TOML/INI subset, for other extensions a file starting with "{"
+// is treated as JSON. Parameters can either be spelled out in full,
+// like "log.file.maxsize", or nested under objects/sections, like
+// {"log": {"file.maxsize": "10MB"}} or [log.file] maxsize = "10MB".
+// Settings are not validated, refer Configure().
+func SettingsFromFile(filename string) (map[string]interface{}, error) {
+	filesetts, err := readsettings(filename)
+	if err != nil {
+		return nil, err
+	}
+	return mergesettings(Defaultsettings(), filesetts), nil
+}
+
+// SettingsFromEnv load settings from environment variables on top of
+// Defaultsettings(). Variables are named as prefix, followed by "_",
+// followed by the parameter name without "log." in upper case, with
+// "." replaced by "_". For example with prefix "GOLOG",
+// GOLOG_LEVEL sets "log.level", GOLOG_FILE_MAXSIZE sets
+// "log.file.maxsize" and GOLOG_COLORERROR sets "log.colorerror".
+// Only variables naming a parameter listed in Defaultsettings(),
+// "log.levels.<prefix>" or "log.sinks.<name>.<param>" are loaded,
+// others, like GOLOG_HOME, are ignored. Default prefix is "GOLOG".
+// Values are strings and are parsed when the logger is configured,
+// refer Configure().
+func SettingsFromEnv(prefix string) map[string]interface{} {
+	return mergesettings(Defaultsettings(), envsettings(prefix))
+}
+
+// LoadSettings load settings with following precedence, lowest first:
+// Defaultsettings(), filename if not empty, environment variables
+// named with prefix. Refer SettingsFromFile() and SettingsFromEnv().
+func LoadSettings(filename, prefix string) (map[string]interface{}, error) {
+	setts := Defaultsettings()
+	if filename != "" {
+		filesetts, err := readsettings(filename)
+		if err != nil {
+			return nil, err
+		}
+		setts = mergesettings(setts, filesetts)
+	}
+	return mergesettings(setts, envsettings(prefix)), nil
+}
+
+// mergesettings copy src parameters into dst, overriding existing
+// parameters, and return dst.
+func mergesettings(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
+
+func readsettings(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var setts map[string]interface{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		setts, err = parsejsonsettings(data)
+	case ".toml", ".ini", ".conf", ".cfg":
+		setts, err = parsetomlsettings(data)
+	default:
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			setts, err = parsejsonsettings(data)
+		} else {
+			setts, err = parsetomlsettings(data)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return setts, nil
+}
+
+func envsettings(prefix string) map[string]interface{} {
+	if prefix = strings.TrimSuffix(prefix, "_"); prefix == "" {
+		prefix = "GOLOG"
+	}
+	prefix += "_"
+	setts := map[string]interface{}{}
+	for _, env := range os.Environ() {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		name = strings.ToLower(strings.TrimPrefix(name, prefix))
+		if key := "log." + strings.Replace(name, "_", ".", -1); envparam(key) {
+			setts[key] = value
+		}
+	}
+	return setts
+}
+
+// envparam return whether key is a parameter that can be loaded from
+// environment.
+func envparam(key string) bool {
+	if _, ok := checkers[key]; ok {
+		return true
+	} else if strings.HasPrefix(key, "log.levels.") {
+		return true
+	} else if rest := strings.TrimPrefix(key, "log.sinks."); rest != key {
+		i := strings.LastIndexByte(rest, '.')
+		_, ok := sinkparams[rest[i+1:]]
+		return i > 0 && ok
+	}
+	return false
+}
+
+// parsejsonsettings flatten nested objects by joining keys with ".",
+// numbers are float64 and arrays are []interface{}.
+func parsejsonsettings(data []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	setts := map[string]interface{}{}
+	flattensettings(setts, "", doc)
+	return setts, nil
+}
+
+func flattensettings(
+	setts map[string]interface{}, prefix string, doc map[string]interface{}) {
+
+	for key, value := range doc {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if obj, ok := value.(map[string]interface{}); ok {
+			flattensettings(setts, key, obj)
+			continue
+		}
+		setts[key] = value
+	}
+}
+
+// parsetomlsettings parse a subset of TOML that is also good enough for
+// INI files: [section] headers, key = value pairs, comments starting
+// with "#" or ";", values as quoted strings, integers, floats,
+// booleans, single line arrays and, for INI, bare strings.
+func parsetomlsettings(data []byte) (map[string]interface{}, error) {
+	setts, section := map[string]interface{}{}, ""
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(stripcomment(line))
+		if line == "" {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("line %v: invalid section %q", i+1, line)
+			}
+			section = unquotekey(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %v: expected key = value", i+1)
+		}
+		if key = unquotekey(key); key == "" {
+			return nil, fmt.Errorf("line %v: missing key", i+1)
+		} else if section != "" {
+			key = section + "." + key
+		}
+		val, err := parsetomlvalue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+		setts[key] = val
+	}
+	return setts, nil
+}
+
+func parsetomlvalue(s string) (interface{}, error) {
+	switch {
+	case s == "":
+		return "", nil
+
+	case s[0] == '"':
+		return strconv.Unquote(s)
+
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("unterminated string %v", s)
+		}
+		return s[1 : len(s)-1], nil
+
+	case s[0] == '[':
+		if s[len(s)-1] != ']' {
+			return nil, fmt.Errorf("unterminated array %v", s)
+		}
+		vals := []interface{}{}
+		for _, item := range splitarray(s[1 : len(s)-1]) {
+			val, err := parsetomlvalue(item)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, val)
+		}
+		return vals, nil
+
+	case s == "true" || s == "false":
+		return s == "true", nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil // bare INI string.
+}
+
+// stripcomment remove "#" or ";" comment that is not within quotes.
+func stripcomment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' || c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitarray split comma separated items, skipping commas within quotes.
+func splitarray(s string) []string {
+	items, quote, start := []string{}, byte(0), 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if item := strings.TrimSpace(s[start:]); item != "" {
+		items = append(items, item)
+	}
+	return items
+}
+
+func unquotekey(key string) string {
+	key = strings.TrimSpace(key)
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') &&
+		key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
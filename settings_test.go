@@ -0,0 +1,153 @@
+package log
+
+import "os"
+import "reflect"
+import "testing"
+import "path/filepath"
+
+func TestSettingsFromJSON(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.json")
+	data := `{
+		"log.level": "debug",
+		"log": {
+			"file": "app.log",
+			"file.maxbackups": 3,
+			"async": {"queuesize": 16},
+			"colorerror": ["bold", "red"]
+		}
+	}`
+	if err := os.WriteFile(filename, []byte(data), 0660); err != nil {
+		t.Fatal(err)
+	}
+	setts, err := SettingsFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := map[string]interface{}{
+		"log.level":           "debug",
+		"log.file":            "app.log",
+		"log.file.maxbackups": float64(3),
+		"log.async.queuesize": float64(16),
+		"log.colorerror":      []interface{}{"bold", "red"},
+		"log.colorfatal":      "red", // from Defaultsettings()
+	}
+	for key, ref := range refs {
+		if !reflect.DeepEqual(setts[key], ref) {
+			t.Errorf("%v expected %v, got %v", key, ref, setts[key])
+		}
+	}
+	if err := validate(setts); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSettingsFromTOML(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.toml")
+	data := `
+# logging
+[log]
+level = "warn"   # inline comment
+flags = ["ldate", "lshortfile"]
+prefix = "[%v] #"
+colorerror = 'hired'
+
+[log.file]
+maxsize = "10MB" ; ini comment
+compress = true
+maxbackups = 2
+name = bare value
+`
+	if err := os.WriteFile(filename, []byte(data), 0660); err != nil {
+		t.Fatal(err)
+	}
+	setts, err := SettingsFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := map[string]interface{}{
+		"log.level":           "warn",
+		"log.flags":           []interface{}{"ldate", "lshortfile"},
+		"log.prefix":          "[%v] #",
+		"log.colorerror":      "hired",
+		"log.file.maxsize":    "10MB",
+		"log.file.compress":   true,
+		"log.file.maxbackups": 2,
+		"log.file.name":       "bare value",
+	}
+	for key, ref := range refs {
+		if !reflect.DeepEqual(setts[key], ref) {
+			t.Errorf("%v expected %#v, got %#v", key, ref, setts[key])
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.ini")
+	if err := os.WriteFile(bad, []byte("[log]\nlevel\n"), 0660); err != nil {
+		t.Fatal(err)
+	} else if _, err := SettingsFromFile(bad); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestSettingsFromEnv(t *testing.T) {
+	t.Setenv("GOLOG_LEVEL", "trace")
+	t.Setenv("GOLOG_FILE_MAXSIZE", "1KB")
+	t.Setenv("GOLOG_COLORERROR", "bold,red")
+	t.Setenv("MYAPP_LOG_LEVEL", "error")
+	t.Setenv("GOLOG_HOME", "/opt/golog")
+	t.Setenv("GOLOG_LEVELS_STORAGE", "debug")
+	t.Setenv("GOLOG_SINKS_CONSOLE_WRITER", "stderr")
+	t.Setenv("GOLOG_SINKS_CONSOLE_HOME", "/opt/golog")
+
+	setts := SettingsFromEnv("")
+	refs := map[string]interface{}{
+		"log.level":                "trace",
+		"log.file.maxsize":         "1KB",
+		"log.colorerror":           "bold,red",
+		"log.colorfatal":           "red",
+		"log.levels.storage":       "debug",
+		"log.sinks.console.writer": "stderr",
+	}
+	for key, ref := range refs {
+		if !reflect.DeepEqual(setts[key], ref) {
+			t.Errorf("%v expected %v, got %v", key, ref, setts[key])
+		}
+	}
+	for _, key := range []string{"log.home", "log.sinks.console.home"} {
+		if _, ok := setts[key]; ok {
+			t.Errorf("unexpected %v", key)
+		}
+	}
+	setts["log.sinks"] = "console"
+	if err := validate(setts); err != nil {
+		t.Error(err)
+	}
+	if setts := SettingsFromEnv("MYAPP_LOG_"); setts["log.level"] != "error" {
+		t.Errorf("unexpected %v", setts["log.level"])
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.conf")
+	data := "[log]\nlevel = debug\nprefix = file\n"
+	if err := os.WriteFile(filename, []byte(data), 0660); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOLOG_LEVEL", "error")
+
+	setts, err := LoadSettings(filename, "GOLOG")
+	if err != nil {
+		t.Fatal(err)
+	} else if setts["log.level"] != "error" {
+		t.Errorf("unexpected %v", setts["log.level"])
+	} else if setts["log.prefix"] != "file" {
+		t.Errorf("unexpected %v", setts["log.prefix"])
+	} else if setts["log.colorwarn"] != "yellow" {
+		t.Errorf("unexpected %v", setts["log.colorwarn"])
+	}
+	if _, err := LoadSettings(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package log
+
+import "os"
+import "fmt"
+import "strings"
+import "syscall"
+
+func string2signal(s string) (os.Signal, error) {
+	switch strings.ToUpper(s) {
+	case "SIGHUP", "HUP":
+		return syscall.SIGHUP, nil
+	case "SIGUSR1", "USR1":
+		return syscall.SIGUSR1, nil
+	case "SIGUSR2", "USR2":
+		return syscall.SIGUSR2, nil
+	}
+	return nil, fmt.Errorf("unsupported signal %q", s)
+}
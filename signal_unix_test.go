@@ -0,0 +1,60 @@
+//go:build !windows
+
+package log
+
+import "os"
+import "testing"
+import "syscall"
+import "path/filepath"
+
+func TestReopenSignal(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	setts := map[string]interface{}{
+		"log.level": "info", "log.file": logfile, "log.timeformat": "",
+		"log.file.reopensignal": "SIGUSR1",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Infof("before")
+	if err := os.Rename(logfile, logfile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	waitfor(t, func() bool {
+		_, err := os.Stat(logfile)
+		return err == nil
+	})
+	logger.Infof("after")
+
+	if data, _ := os.ReadFile(logfile + ".1"); string(data) != "[Infom] before\n" {
+		t.Errorf("unexpected %q", data)
+	}
+	if data, _ := os.ReadFile(logfile); string(data) != "[Infom] after\n" {
+		t.Errorf("unexpected %q", data)
+	}
+}
+
+func TestWatchSignal(t *testing.T) {
+	dir := t.TempDir()
+	conffile := filepath.Join(dir, "log.ini")
+	if err := os.WriteFile(conffile, []byte("log.level = info\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Watch(conffile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetLogger(nil, Defaultsettings())
+	defer w.Close()
+
+	if err := os.WriteFile(conffile, []byte("log.level = warn\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	waitfor(t, func() bool { return !Enabled(LogLevelInfo) })
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package log
+
+import "os"
+import "fmt"
+import "strings"
+import "syscall"
+
+func string2signal(s string) (os.Signal, error) {
+	switch strings.ToUpper(s) {
+	case "SIGHUP", "HUP":
+		return syscall.SIGHUP, nil
+	}
+	return nil, fmt.Errorf("unsupported signal %q", s)
+}
@@ -0,0 +1,446 @@
+package log
+
+import "io"
+import "os"
+import "fmt"
+import "sort"
+import "sync"
+import "strings"
+
+// sink is an output of defaultLogger, records from maxlevel, the most
+// severe, upto minlevel, the least severe, are encoded in sink's format
+// and written to out. Every sink serializes its own writes, and can
+// queue records in its own asyncWriter, such that a slow sink does not
+// hold up others.
+type sink struct {
+	name     string   // empty for the output configured by log.file.
+	kind     string   // refer checkwriter(), "writer" for io.Writer.
+	minlevel LogLevel // least severe level, like log.level.
+	maxlevel LogLevel // most severe level.
+	format   string   // empty to follow log.format.
+	color    bool
+	enc      recordencoder // nil to encode as per format.
+	mu       sync.Mutex    // serialize writes to out.
+	out      io.Writer     // can be *asyncWriter.
+}
+
+// recordencoder is implemented by sink writers with their own wire
+// format, like syslog, for which format and color are ignored.
+type recordencoder interface {
+	encoderecord(r *record) []byte
+}
+
+// sinkparams accepted for "log.sinks.<name>.<param>".
+var sinkparams = map[string]checker{
+	"writer":        checkwriter,
+	"file":          checkstring,
+	"minlevel":      checklevel,
+	"maxlevel":      checklevel,
+	"format":        checkformat,
+	"color":         checkbool,
+	"async":         checkbool,
+	"network":       checknetwork,
+	"address":       checkstring,
+	"facility":      checkfacility,
+	"appname":       checkstring,
+	"protocol":      checkprotocol,
+	"tls":           checkbool,
+	"tlsca":         checkstring,
+	"tlscert":       checkstring,
+	"tlskey":        checkstring,
+	"tlsservername": checkstring,
+	"spool":         checkstring,
+	"spoolsize":     checksize,
+	"maxbackoff":    checkduration,
+}
+
+// writerparams lists writers accepting the parameter.
+var writerparams = map[string][]string{
+	"network":       {"syslog", "stream"},
+	"address":       {"syslog", "journald", "stream"},
+	"facility":      {"syslog"},
+	"appname":       {"syslog", "journald"},
+	"protocol":      {"syslog"},
+	"tls":           {"stream"},
+	"tlsca":         {"stream"},
+	"tlscert":       {"stream"},
+	"tlskey":        {"stream"},
+	"tlsservername": {"stream"},
+	"spool":         {"stream"},
+	"spoolsize":     {"stream"},
+	"maxbackoff":    {"stream"},
+}
+
+// paramnames of writerparams, sorted, such that errors are reported
+// in the same order as validate().
+var paramnames = func() []string {
+	names := make([]string, 0, len(writerparams))
+	for param := range writerparams {
+		names = append(names, param)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// newsink for out, logging all levels.
+func newsink(name, kind string, out io.Writer) *sink {
+	return &sink{
+		name: name, kind: kind, minlevel: LogLevelTrace,
+		maxlevel: LogLevelFatal, color: true, out: out,
+	}
+}
+
+// opensinks for validated setts. If "log.sinks" is empty a single
+// sink writing to w, else "log.file", else os.Stdout, is returned.
+func opensinks(w io.Writer, setts map[string]interface{}) ([]*sink, error) {
+	names, err := settingcsv(setts, "log.sinks")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		kind := "writer"
+		if w == nil {
+			if w, err = openoutput(setts); err != nil {
+				return nil, err
+			}
+			kind = outputkind(w)
+		}
+		s := newsink("", kind, w)
+		if async, _ := settingbool(setts, "log.async"); async {
+			if s.out, err = newAsyncWriter(s.out, setts); err != nil {
+				s.close()
+				return nil, err
+			}
+		}
+		return []*sink{s}, nil
+	}
+
+	sinks := []*sink{}
+	for _, name := range names {
+		s, err := opensink(name, w, setts)
+		if err != nil {
+			for _, s := range sinks {
+				s.close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// opensink read "log.sinks.<name>.*" parameters from setts. Sinks
+// without writer and file write to w, if not nil, else to os.Stdout.
+func opensink(
+	name string, w io.Writer, setts map[string]interface{}) (*sink, error) {
+
+	key := "log.sinks." + name + "."
+	s := newsink(name, "stdout", os.Stdout)
+	if w != nil {
+		s.kind, s.out = "writer", w
+	}
+	switch writer := setts[key+"writer"].(type) {
+	case io.Writer:
+		s.kind, s.out = "writer", writer
+	case string:
+		switch strings.ToLower(writer) {
+		case "stdout":
+			s.kind, s.out = "stdout", os.Stdout
+		case "stderr":
+			s.kind, s.out = "stderr", os.Stderr
+		case "syslog":
+			sw, err := newSyslogWriter(name, setts)
+			if err != nil {
+				return nil, err
+			}
+			s.kind, s.out, s.enc = "syslog", sw, sw
+		case "journald":
+			jw, err := newJournaldWriter(name, setts)
+			if err != nil {
+				return nil, err
+			}
+			s.kind, s.out, s.enc = "journald", jw, jw
+		case "stream":
+			sw, err := newStreamWriter(name, setts)
+			if err != nil {
+				return nil, err
+			}
+			s.kind, s.out = "stream", sw
+		}
+	}
+	// validated, file is supplied only with "file" or empty writer.
+	if filename, _ := settingstring(setts, key+"file"); filename != "" {
+		f, err := newRotatingFile(filename, setts)
+		if err != nil {
+			return nil, err
+		}
+		s.kind, s.out = "file", f
+	}
+
+	if level, _ := settingstring(setts, key+"minlevel"); level != "" {
+		s.minlevel, _ = ParseLevel(level)
+	}
+	if level, _ := settingstring(setts, key+"maxlevel"); level != "" {
+		s.maxlevel, _ = ParseLevel(level)
+	}
+	if format, _ := settingstring(setts, key+"format"); format != "" {
+		s.format, _ = string2format(format)
+	}
+	if s.kind == "stream" { // validated, newline delimited JSON.
+		s.format = "json"
+	}
+	// colors only for terminals, unless asked for.
+	s.color = s.kind == "stdout" || s.kind == "stderr"
+	if _, ok := setts[key+"color"]; ok {
+		s.color, _ = settingbool(setts, key+"color")
+	}
+	async, _ := settingbool(setts, "log.async")
+	if _, ok := setts[key+"async"]; ok {
+		async, _ = settingbool(setts, key+"async")
+	}
+	if async {
+		aw, err := newAsyncWriter(s.out, setts)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.out = aw
+	}
+	return s, nil
+}
+
+func outputkind(w io.Writer) string {
+	switch w {
+	case os.Stdout:
+		return "stdout"
+	case os.Stderr:
+		return "stderr"
+	}
+	if _, ok := w.(*rotatingFile); ok {
+		return "file"
+	}
+	return "writer"
+}
+
+// accept return whether records at level shall be written to sink.
+func (s *sink) accept(level LogLevel) bool {
+	return level <= s.minlevel && level >= s.maxlevel
+}
+
+// write line, caller shall not reuse line.
+func (s *sink) write(level LogLevel, line []byte) {
+	if aw, ok := s.out.(*asyncWriter); ok {
+		aw.writelevel(level, line)
+		return
+	}
+	s.mu.Lock()
+	s.out.Write(line)
+	s.mu.Unlock()
+}
+
+func (s *sink) flush() error {
+	if aw, ok := s.out.(*asyncWriter); ok {
+		return aw.Flush()
+	}
+	return nil
+}
+
+func (s *sink) dropped() uint64 {
+	dropped := uint64(0)
+	if aw, ok := s.out.(*asyncWriter); ok {
+		dropped = aw.Dropped()
+	}
+	if sw, ok := s.writer().(*streamWriter); ok {
+		dropped += sw.Dropped()
+	}
+	return dropped
+}
+
+// writer return sink's output, unwrapping asyncWriter.
+func (s *sink) writer() io.Writer {
+	if aw, ok := s.out.(*asyncWriter); ok {
+		return aw.out
+	}
+	return s.out
+}
+
+// logfile return the log file writer, if sink is writing to one.
+func (s *sink) logfile() *rotatingFile {
+	f, _ := s.writer().(*rotatingFile)
+	return f
+}
+
+// close drain queued records and close log file or connection,
+// other writers are owned by the application and left open.
+func (s *sink) close() error {
+	var err error
+	out := s.out
+	if aw, ok := out.(*asyncWriter); ok {
+		err, out = aw.Close(), aw.out
+	}
+	switch out.(type) {
+	case *rotatingFile, *syslogWriter, *journaldWriter, *streamWriter:
+		if cerr := out.(io.Closer).Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// settings add "log.sinks.<name>.*" parameters of sink to setts.
+func (s *sink) settings(setts map[string]interface{}) {
+	key := "log.sinks." + s.name + "."
+	setts[key+"writer"], setts[key+"file"] = s.kind, ""
+	if f := s.logfile(); f != nil {
+		setts[key+"file"] = f.name()
+	}
+	setts[key+"minlevel"] = s.minlevel.Name()
+	setts[key+"maxlevel"] = s.maxlevel.Name()
+	setts[key+"format"] = s.format
+	setts[key+"color"] = s.color
+	_, setts[key+"async"] = s.out.(*asyncWriter)
+	if w, ok := s.writer().(interface {
+		settings(setts map[string]interface{}, key string)
+	}); ok {
+		w.settings(setts, key)
+	}
+}
+
+// checksinks validate "log.sinks" along with parameters of listed
+// sinks that depend on each other.
+func checksinks(setts map[string]interface{}, key string) error {
+	names, err := settingcsv(setts, key)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if strings.ContainsAny(name, ". \t") {
+			return fmt.Errorf("invalid value for %q: invalid sink %q", key, name)
+		} else if seen[name] {
+			return fmt.Errorf("invalid value for %q: duplicate sink %q", key, name)
+		}
+		seen[name] = true
+
+		prefix := key + "." + name + "."
+		minlevel, _ := setts[prefix+"minlevel"].(string)
+		maxlevel, _ := setts[prefix+"maxlevel"].(string)
+		if minlevel != "" && maxlevel != "" {
+			min, err1 := ParseLevel(minlevel)
+			max, err2 := ParseLevel(maxlevel)
+			if err1 == nil && err2 == nil && min < max {
+				fmsg := "invalid value for %q: minlevel %q is more severe " +
+					"than maxlevel %q"
+				return fmt.Errorf(fmsg, key, minlevel, maxlevel)
+			}
+		}
+		writer, filename := setts[prefix+"writer"], setts[prefix+"file"]
+		if s, ok := writer.(string); ok {
+			writer = strings.ToLower(s)
+		}
+		if writer == "file" && (filename == nil || filename == "") {
+			fmsg := "invalid value for %q: sink %q missing file"
+			return fmt.Errorf(fmsg, key, name)
+		} else if writer != nil && writer != "" && writer != "file" &&
+			filename != nil && filename != "" {
+
+			fmsg := "invalid value for %q: sink %q has both writer and file"
+			return fmt.Errorf(fmsg, key, name)
+		}
+		if writer == "stream" {
+			if err := checkstream(setts, key, prefix); err != nil {
+				return err
+			}
+		}
+		for _, param := range paramnames {
+			writers := writerparams[param]
+			if setts[prefix+param] == nil {
+				continue
+			}
+			ok := false
+			for _, w := range writers {
+				ok = ok || writer == w
+			}
+			if !ok {
+				fmsg := "invalid value for %q: %q only for %v writer"
+				return fmt.Errorf(fmsg, key, prefix+param, strings.Join(writers, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// checksink validate "log.sinks.<name>.<param>", sink shall be listed
+// in "log.sinks".
+func checksink(setts map[string]interface{}, key string) error {
+	rest := strings.TrimPrefix(key, "log.sinks.")
+	i := strings.LastIndexByte(rest, '.')
+	if i < 0 {
+		return fmt.Errorf("unknown parameter %q", key)
+	}
+	name, param := rest[:i], rest[i+1:]
+	check, ok := sinkparams[param]
+	if !ok {
+		return fmt.Errorf("unknown parameter %q", key)
+	}
+	names, _ := settingcsv(setts, "log.sinks")
+	for _, n := range names {
+		if n == name {
+			return check(setts, key)
+		}
+	}
+	return fmt.Errorf("parameter %q for sink %q not in \"log.sinks\"", key, name)
+}
+
+// checkstream validate parameters of sink prefix with "stream" writer.
+func checkstream(setts map[string]interface{}, key, prefix string) error {
+	address, _ := setts[prefix+"address"].(string)
+	network, _ := setts[prefix+"network"].(string)
+	format, _ := setts[prefix+"format"].(string)
+	if address == "" {
+		fmsg := "invalid value for %q: %q missing address"
+		return fmt.Errorf(fmsg, key, strings.TrimSuffix(prefix, "."))
+	}
+	switch network = strings.ToLower(network); network {
+	case "", "tcp", "tcp4", "tcp6", "unix":
+	default:
+		fmsg := "invalid value for %q: %q stream network %q"
+		return fmt.Errorf(fmsg, key, prefix+"network", network)
+	}
+	if f, err := string2format(format); format != "" && (err != nil || f != "json") {
+		fmsg := "invalid value for %q: %q stream format is json"
+		return fmt.Errorf(fmsg, key, prefix+"format")
+	}
+	cert, _ := setts[prefix+"tlscert"].(string)
+	tlskey, _ := setts[prefix+"tlskey"].(string)
+	if (cert == "") != (tlskey == "") {
+		fmsg := "invalid value for %q: %q needs both tlscert and tlskey"
+		return fmt.Errorf(fmsg, key, strings.TrimSuffix(prefix, "."))
+	}
+	enable, _ := settingbool(setts, prefix+"tls")
+	ca, _ := setts[prefix+"tlsca"].(string)
+	servername, _ := setts[prefix+"tlsservername"].(string)
+	if network == "unix" && (enable || ca != "" || cert != "") && servername == "" {
+		fmsg := "invalid value for %q: %q needs tlsservername over unix"
+		return fmt.Errorf(fmsg, key, strings.TrimSuffix(prefix, "."))
+	}
+	return nil
+}
+
+// checkwriter validate sink writer, can be "stdout", "stderr",
+// "file", "syslog", "journald", "stream" or an io.Writer.
+func checkwriter(setts map[string]interface{}, key string) error {
+	switch writer := setts[key].(type) {
+	case nil, io.Writer:
+		return nil
+	case string:
+		switch strings.ToLower(writer) {
+		case "", "stdout", "stderr", "file", "syslog", "journald", "stream":
+			return nil
+		}
+		fmsg := "invalid value for %q: unexpected writer %q"
+		return fmt.Errorf(fmsg, key, writer)
+	}
+	fmsg := "invalid type: parameter %q has %T, expected string or io.Writer"
+	return fmt.Errorf(fmsg, key, setts[key])
+}
@@ -0,0 +1,176 @@
+package log
+
+import "bytes"
+import "strings"
+import "testing"
+import "io/ioutil"
+import "path/filepath"
+
+func TestSinks(t *testing.T) {
+	var errbuf, allbuf bytes.Buffer
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	setts := map[string]interface{}{
+		"log.level":                 "debug",
+		"log.timeformat":            "",
+		"log.sinks":                 "errors,all,file",
+		"log.sinks.errors.writer":   &errbuf,
+		"log.sinks.errors.minlevel": "error",
+		"log.sinks.errors.format":   "logfmt",
+		"log.sinks.all.writer":      &allbuf,
+		"log.sinks.all.maxlevel":    "warn",
+		"log.sinks.file.file":       logfile,
+		"log.sinks.file.minlevel":   "info",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Errorf("disk full")
+	logger.Warnw("slow", "ms", 10)
+	logger.Infof("hello")
+	logger.Debugf("details")
+	logger.Fatalf("down")
+
+	if s := errbuf.String(); !strings.Contains(s, "level=Error msg=\"disk full\" caller=") ||
+		!strings.Contains(s, "level=Fatal msg=down caller=") ||
+		strings.Count(s, "\n") != 2 {
+
+		t.Errorf("unexpected %q", s)
+	}
+	if s, ref := allbuf.String(), "[Warng] slow ms=10\n[Infom] hello\n[Debug] details\n"; s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+
+	setts = logger.(*defaultLogger).Settings()
+	if s := setts["log.sinks"]; s != "errors,all,file" {
+		t.Errorf("unexpected %v", s)
+	} else if s := setts["log.sinks.file.file"]; s != logfile {
+		t.Errorf("unexpected %v", s)
+	} else if s := setts["log.sinks.errors.minlevel"]; s != "error" {
+		t.Errorf("unexpected %v", s)
+	} else if s := setts["log.sinks.errors.maxlevel"]; s != "fatal" {
+		t.Errorf("unexpected %v", s)
+	} else if s := setts["log.sinks.all.writer"]; s != "writer" {
+		t.Errorf("unexpected %v", s)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "[Error] disk full\n[Warng] slow ms=10\n[Infom] hello\n[Fatal] down\n"
+	if s := string(data); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+}
+
+func TestSinkColor(t *testing.T) {
+	var plain, colored bytes.Buffer
+	setts := map[string]interface{}{
+		"log.timeformat":             "",
+		"log.sinks":                  "plain,colored,console",
+		"log.sinks.plain.writer":     &plain,
+		"log.sinks.colored.writer":   &colored,
+		"log.sinks.colored.color":    true,
+		"log.sinks.console.writer":   "stderr",
+		"log.sinks.console.minlevel": "ignore",
+		"log.sinks.console.maxlevel": "ignore",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setts = logger.(*defaultLogger).Settings()
+	refs := map[string]bool{"plain": false, "colored": true, "console": true}
+	for name, ref := range refs {
+		if color := setts["log.sinks."+name+".color"]; color != ref {
+			t.Errorf("%v expected %v, got %v", name, ref, color)
+		}
+	}
+	logger.Errorf("failed")
+	if s := plain.String(); s != "[Error] failed\n" {
+		t.Errorf("unexpected %q", s)
+	}
+}
+
+func TestSlowSink(t *testing.T) {
+	var fast bytes.Buffer
+	slow := &gatedWriter{gate: make(chan struct{})}
+	setts := map[string]interface{}{
+		"log.timeformat":        "",
+		"log.sinks":             "slow,fast",
+		"log.sinks.slow.writer": slow,
+		"log.sinks.slow.async":  true,
+		"log.sinks.fast.writer": &fast,
+		"log.async.queuesize":   2,
+		"log.async.overflow":    "dropnewest",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Infof("record %v", i)
+	}
+	if n := strings.Count(fast.String(), "\n"); n != 10 {
+		t.Errorf("expected 10 records, got %v", n)
+	}
+	close(slow.gate)
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dropped := logger.(*defaultLogger).Dropped()
+	if n := uint64(strings.Count(slow.String(), "\n")); n+dropped != 10 || dropped == 0 {
+		t.Errorf("unexpected %v records, %v dropped", n, dropped)
+	}
+}
+
+func TestSinkConfig(t *testing.T) {
+	testcases := []map[string]interface{}{
+		{"log.sinks": "a.b"},
+		{"log.sinks": "a,a"},
+		{"log.sinks": "a", "log.sinks.a.level": "info"},
+		{"log.sinks": "a", "log.sinks.b.format": "json"},
+		{"log.sinks": "a", "log.sinks.a.writer": "tty"},
+		{"log.sinks": "a", "log.sinks.a.writer": 10},
+		{"log.sinks": "a", "log.sinks.a.writer": "file"},
+		{"log.sinks": "a", "log.sinks.a.writer": "stderr", "log.sinks.a.file": "x.log"},
+		{"log.sinks": "a", "log.sinks.a.minlevel": "info", "log.sinks.a.maxlevel": "debug"},
+		{"log.sinks": "a", "log.sinks.a.maxlevel": "loud"},
+		{"log.sinks": "a", "log.sinks.a.format": "xml"},
+		{"log.sinks": "a", "log.sinks.a.color": "maybe"},
+	}
+	for _, setts := range testcases {
+		if err := validate(setts); err == nil {
+			t.Errorf("expected error for %v", setts)
+		}
+	}
+	setts := map[string]interface{}{
+		"log.sinks": "a,b", "log.sinks.a.writer": "stderr",
+		"log.sinks.a.minlevel": "error", "log.sinks.a.maxlevel": "fatal",
+		"log.sinks.b.writer": "stdout", "log.sinks.b.format": "json",
+	}
+	if err := validate(setts); err != nil {
+		t.Error(err)
+	}
+
+	// with several invalid parameters, the same error is reported.
+	setts = map[string]interface{}{
+		"log.sinks": "a", "log.sinks.a.writer": "stderr",
+		"log.sinks.a.address": "x", "log.sinks.a.facility": "user",
+		"log.sinks.a.spool": "/tmp", "log.sinks.a.tls": true,
+	}
+	ref := validate(setts).Error()
+	for i := 0; i < 20; i++ {
+		if err := validate(setts); err.Error() != ref {
+			t.Fatalf("expected %v, got %v", ref, err)
+		}
+	}
+	if !strings.Contains(ref, "log.sinks.a.address") {
+		t.Errorf("unexpected %v", ref)
+	}
+}
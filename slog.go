@@ -0,0 +1,341 @@
+package log
+
+import "fmt"
+import "time"
+import "context"
+import "runtime"
+import "log/slog"
+import "sync/atomic"
+
+// Log levels are mapped to slog levels as,
+//
+//	golog     slog
+//	fatal     slog.LevelError+4 (12)
+//	error     slog.LevelError   (8)
+//	warn      slog.LevelWarn    (4)
+//	info      slog.LevelInfo    (0)
+//	verbose   slog.LevelDebug+2 (-2)
+//	debug     slog.LevelDebug   (-4)
+//	trace     slog.LevelDebug-4 (-8)
+//
+// slog levels in between are rounded down to the nearest golog level,
+// levels above fatal map to fatal and levels below trace map to trace.
+// Ignore is not a record level and maps above fatal.
+
+// SlogLevel return slog level for golog level, refer mapping above.
+func SlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelIgnore:
+		return slog.LevelError + 8
+	case LogLevelFatal:
+		return slog.LevelError + 4
+	case LogLevelError:
+		return slog.LevelError
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelVerbose:
+		return slog.LevelDebug + 2
+	case LogLevelDebug:
+		return slog.LevelDebug
+	}
+	return slog.LevelDebug - 4
+}
+
+// LevelFromSlog return golog level for slog level, refer mapping above.
+func LevelFromSlog(level slog.Level) LogLevel {
+	switch {
+	case level >= slog.LevelError+4:
+		return LogLevelFatal
+	case level >= slog.LevelError:
+		return LogLevelError
+	case level >= slog.LevelWarn:
+		return LogLevelWarn
+	case level >= slog.LevelInfo:
+		return LogLevelInfo
+	case level >= slog.LevelDebug+2:
+		return LogLevelVerbose
+	case level >= slog.LevelDebug:
+		return LogLevelDebug
+	}
+	return LogLevelTrace
+}
+
+// slogHandler render slog records through golog.
+type slogHandler struct {
+	logger Logger  // nil for default logger.
+	fields []Field // from WithAttrs, keys qualified by group.
+	group  string  // group prefix, like "req.", for attributes.
+}
+
+// NewSlogHandler return a slog.Handler that renders records using
+// logger, with golog's prefix, timeformat, colors and format. If
+// logger is nil records are rendered using the default logger,
+// following SetLogger(). Attributes within groups are logged with
+// keys qualified by the group name, like "req.method". Refer
+// SlogLevel() for level mapping.
+//
+//	slog.SetDefault(slog.New(log.NewSlogHandler(nil)))
+//
+// Note that a logger created by FromSlog() using the default slog
+// handler shall not be used here, that would loop.
+func NewSlogHandler(logger Logger) slog.Handler {
+	return &slogHandler{logger: logger}
+}
+
+func (h *slogHandler) target() Logger {
+	logger := h.logger
+	if logger == nil {
+		logger = getlog()
+	}
+	if n, ok := logger.(*namedLogger); ok {
+		return n.logger()
+	}
+	return logger
+}
+
+// Enabled implement slog.Handler.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.target().Enabled(LevelFromSlog(level))
+}
+
+// Handle implement slog.Handler, record's time and caller are
+// retained when logging through a golog logger. Fields from registered
+// extractors are picked from ctx, refer FromContext().
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]Field, 0, len(h.fields)+r.NumAttrs())
+	fields = append(fields, h.fields...)
+	if ctx != nil {
+		fields = contextfields(fields, ctx)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendattr(fields, h.group, attr)
+		return true
+	})
+
+	level := LevelFromSlog(r.Level)
+	switch logger := h.target().(type) {
+	case *defaultLogger:
+		when := r.Time
+		if when.IsZero() {
+			when = time.Now()
+		}
+		logger.emit(when, level, r.Message, fields, r.PC)
+
+	default:
+		keyvals := make([]interface{}, 0, len(fields)*2)
+		for _, field := range fields {
+			keyvals = append(keyvals, field.Key, field.Value)
+		}
+		logger.Printlw(level, r.Message, keyvals...)
+	}
+	return nil
+}
+
+// WithAttrs implement slog.Handler.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *h
+	child.fields = make([]Field, 0, len(h.fields)+len(attrs))
+	child.fields = append(child.fields, h.fields...)
+	for _, attr := range attrs {
+		child.fields = appendattr(child.fields, h.group, attr)
+	}
+	return &child
+}
+
+// WithGroup implement slog.Handler.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	child := *h
+	child.group = h.group + name + "."
+	return &child
+}
+
+// appendattr flatten attr into fields, following slog.Handler rules:
+// empty attributes are ignored, groups without key are inlined.
+func appendattr(fields []Field, group string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		attrs := attr.Value.Group()
+		if len(attrs) == 0 {
+			return fields
+		} else if attr.Key != "" {
+			group = group + attr.Key + "."
+		}
+		for _, attr := range attrs {
+			fields = appendattr(fields, group, attr)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: group + attr.Key, Value: attr.Value.Any()})
+}
+
+// slogLogger adapt a slog.Handler to Logger.
+type slogLogger struct {
+	handler slog.Handler
+	level   *int64 // atomic LogLevel, shared with child loggers.
+}
+
+// FromSlog return a Logger writing records to handler, such that
+// libraries logging with golog can share output with slog. Log level
+// defaults to trace, leaving the decision to handler.Enabled(),
+// SetLogLevel can restrict it further. Formatting is left to handler,
+// hence SetLogFlags, SetTimeFormat, SetLogprefix and SetLogcolor are
+// no-ops. Refer SlogLevel() for level mapping.
+//
+//	log.SetLogger(log.FromSlog(slog.Default().Handler()), nil)
+func FromSlog(handler slog.Handler) Logger {
+	level := int64(LogLevelTrace)
+	return &slogLogger{handler: handler, level: &level}
+}
+
+// SetLogLevel for slogLogger.
+func (l *slogLogger) SetLogLevel(level string) {
+	ll, err := ParseLevel(level)
+	if err != nil {
+		panic(err)
+	}
+	atomic.StoreInt64(l.level, int64(ll))
+}
+
+// SetLogFlags for slogLogger is a no-op.
+func (l *slogLogger) SetLogFlags(flags int) {}
+
+// SetTimeFormat for slogLogger is a no-op.
+func (l *slogLogger) SetTimeFormat(format string) {}
+
+// SetLogprefix for slogLogger is a no-op.
+func (l *slogLogger) SetLogprefix(prefix interface{}) {}
+
+// SetLogcolor for slogLogger is a no-op.
+func (l *slogLogger) SetLogcolor(level string, attrs []string) {}
+
+// Fatalf for slogLogger
+func (l *slogLogger) Fatalf(format string, v ...interface{}) {
+	l.Printlf(LogLevelFatal, format, v...)
+}
+
+// Errorf for slogLogger
+func (l *slogLogger) Errorf(format string, v ...interface{}) {
+	l.Printlf(LogLevelError, format, v...)
+}
+
+// Warnf for slogLogger
+func (l *slogLogger) Warnf(format string, v ...interface{}) {
+	l.Printlf(LogLevelWarn, format, v...)
+}
+
+// Infof for slogLogger
+func (l *slogLogger) Infof(format string, v ...interface{}) {
+	l.Printlf(LogLevelInfo, format, v...)
+}
+
+// Verbosef for slogLogger
+func (l *slogLogger) Verbosef(format string, v ...interface{}) {
+	l.Printlf(LogLevelVerbose, format, v...)
+}
+
+// Debugf for slogLogger
+func (l *slogLogger) Debugf(format string, v ...interface{}) {
+	l.Printlf(LogLevelDebug, format, v...)
+}
+
+// Tracef for slogLogger
+func (l *slogLogger) Tracef(format string, v ...interface{}) {
+	l.Printlf(LogLevelTrace, format, v...)
+}
+
+// Printlf for slogLogger
+func (l *slogLogger) Printlf(level LogLevel, format string, v ...interface{}) {
+	if l.Enabled(level) {
+		l.handle(level, fmt.Sprintf(trimformat(format), v...), nil)
+	}
+}
+
+// With for slogLogger.
+func (l *slogLogger) With(keyvals ...interface{}) Logger {
+	fields := kv2fields(nil, keyvals)
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, field := range fields {
+		attrs = append(attrs, slog.Any(field.Key, field.Value))
+	}
+	return &slogLogger{handler: l.handler.WithAttrs(attrs), level: l.level}
+}
+
+// Fatalw for slogLogger
+func (l *slogLogger) Fatalw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelFatal, msg, keyvals...)
+}
+
+// Errorw for slogLogger
+func (l *slogLogger) Errorw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelError, msg, keyvals...)
+}
+
+// Warnw for slogLogger
+func (l *slogLogger) Warnw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelWarn, msg, keyvals...)
+}
+
+// Infow for slogLogger
+func (l *slogLogger) Infow(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelInfo, msg, keyvals...)
+}
+
+// Verbosew for slogLogger
+func (l *slogLogger) Verbosew(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelVerbose, msg, keyvals...)
+}
+
+// Debugw for slogLogger
+func (l *slogLogger) Debugw(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelDebug, msg, keyvals...)
+}
+
+// Tracew for slogLogger
+func (l *slogLogger) Tracew(msg string, keyvals ...interface{}) {
+	l.Printlw(LogLevelTrace, msg, keyvals...)
+}
+
+// Printlw for slogLogger
+func (l *slogLogger) Printlw(level LogLevel, msg string, keyvals ...interface{}) {
+	if l.Enabled(level) {
+		l.handle(level, trimformat(msg), kv2fields(nil, keyvals))
+	}
+}
+
+// Enabled for slogLogger.
+func (l *slogLogger) Enabled(level LogLevel) bool {
+	if level > LogLevel(atomic.LoadInt64(l.level)) {
+		return false
+	}
+	return l.handler.Enabled(context.Background(), SlogLevel(level))
+}
+
+// Sync for slogLogger is a no-op.
+func (l *slogLogger) Sync() error {
+	return nil
+}
+
+// Close for slogLogger is a no-op, handler is owned by the caller.
+func (l *slogLogger) Close() error {
+	return nil
+}
+
+// handle shall be called only from Printlf and Printlw, such that
+// caller can be located.
+func (l *slogLogger) handle(level LogLevel, msg string, fields []Field) {
+	var pcs [1]uintptr
+	runtime.Callers(4, pcs[:])
+	r := slog.NewRecord(time.Now(), SlogLevel(level), msg, pcs[0])
+	for _, field := range fields {
+		r.AddAttrs(slog.Any(field.Key, field.Value))
+	}
+	l.handler.Handle(context.Background(), r)
+}
@@ -0,0 +1,115 @@
+package log
+
+import "bytes"
+import "context"
+import "strings"
+import "testing"
+import "log/slog"
+
+func TestSlogLevel(t *testing.T) {
+	levels := []LogLevel{
+		LogLevelFatal, LogLevelError, LogLevelWarn, LogLevelInfo,
+		LogLevelVerbose, LogLevelDebug, LogLevelTrace,
+	}
+	for i, level := range levels {
+		slevel := SlogLevel(level)
+		if ll := LevelFromSlog(slevel); ll != level {
+			t.Errorf("expected %v, got %v", level, ll)
+		} else if i > 0 && slevel >= SlogLevel(levels[i-1]) {
+			t.Errorf("%v not ordered", level)
+		}
+	}
+	testcases := []struct {
+		slevel slog.Level
+		level  LogLevel
+	}{
+		{slog.LevelError + 100, LogLevelFatal},
+		{slog.LevelWarn + 1, LogLevelWarn},
+		{slog.LevelInfo - 1, LogLevelVerbose},
+		{slog.LevelDebug - 1, LogLevelTrace},
+		{slog.LevelDebug - 100, LogLevelTrace},
+	}
+	for _, tc := range testcases {
+		if ll := LevelFromSlog(tc.slevel); ll != tc.level {
+			t.Errorf("%v expected %v, got %v", tc.slevel, tc.level, ll)
+		}
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	setts := map[string]interface{}{
+		"log.level": "verbose", "log.timeformat": "", "log.flags": "lshortfile",
+	}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	slogger := slog.New(NewSlogHandler(nil))
+	slogger.Info("hello", "n", 1)
+	slogger.Debug("hidden")
+	slogger.Log(context.Background(), slog.LevelDebug+2, "verbose")
+	slogger.With("req", 7).WithGroup("http").Warn("slow",
+		slog.Group("resp", "code", 200), slog.Group("empty"), "ms", 12)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	refs := []string{
+		"[Infom] hello n=1",
+		"[Verbs] verbose",
+		"[Warng] slow req=7 http.resp.code=200 http.ms=12",
+	}
+	if len(lines) != len(refs) {
+		t.Fatalf("unexpected %q", lines)
+	}
+	for i, ref := range refs {
+		if !strings.HasPrefix(lines[i], "slog_test.go:") {
+			t.Errorf("expected caller in %q", lines[i])
+		} else if !strings.HasSuffix(lines[i], ref) {
+			t.Errorf("expected %q, got %q", ref, lines[i])
+		}
+	}
+
+	// handler bound to a named logger.
+	buf.Reset()
+	logger.SetLogFlags(0)
+	slog.New(NewSlogHandler(Named("slogtest"))).Error("failed")
+	if s := buf.String(); s != "[Error] slogtest: failed\n" {
+		t.Errorf("unexpected %q", s)
+	}
+}
+
+func TestFromSlog(t *testing.T) {
+	var buf bytes.Buffer
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug - 4, AddSource: true}
+	handler := slog.NewTextHandler(&buf, opts)
+	logger := FromSlog(handler)
+
+	logger.Tracef("trace %v", 1)
+	logger.With("req", 7).Infow("hello", "n", 2)
+	logger.SetLogLevel("info")
+	logger.Debugf("hidden")
+	logger.Fatalf("fatal")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	refs := []string{
+		`level=DEBUG-4 source=`, `msg="trace 1"`,
+		`level=INFO source=`, `msg=hello req=7 n=2`,
+		`level=ERROR+4 source=`, `msg=fatal`,
+	}
+	if len(lines) != 3 {
+		t.Fatalf("unexpected %q", lines)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, refs[2*i]) || !strings.Contains(line, refs[2*i+1]) {
+			t.Errorf("unexpected %q", line)
+		} else if !strings.Contains(line, "slog_test.go:") {
+			t.Errorf("expected caller in %q", line)
+		}
+	}
+	if logger.Enabled(LogLevelDebug) || !logger.Enabled(LogLevelInfo) {
+		t.Errorf("unexpected level")
+	}
+}
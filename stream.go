@@ -0,0 +1,472 @@
+package log
+
+import "os"
+import "fmt"
+import "net"
+import "sort"
+import "sync"
+import "time"
+import "bytes"
+import "errors"
+import "strconv"
+import "strings"
+import "sync/atomic"
+import "crypto/tls"
+import "crypto/x509"
+import "path/filepath"
+
+const (
+	streamdialtimeout  = 5 * time.Second
+	streamwritetimeout = 10 * time.Second
+	streambackoff      = 100 * time.Millisecond
+	streambatch        = 64 << 10 // replay spool in batches of this size.
+	streammaxbackoff   = 30 * time.Second
+	spoolext           = ".spool"
+)
+
+// errStreamDown is returned for records dropped while the collector
+// is not reachable.
+var errStreamDown = errors.New("stream sink disconnected")
+
+// streamWriter send newline delimited JSON records to a collector,
+// like Fluent Bit or Vector, over a tcp or unix stream socket,
+// optionally using TLS. Connections are made by a background goroutine,
+// with exponential backoff upto maxbackoff. While disconnected, records
+// are appended to an on-disk spool, if configured, else dropped.
+// Spooled records are replayed in order before any new record is sent,
+// writers keep spooling while replay is in progress. Delivery is
+// at-least-once, a record cut short by a failing connection is sent
+// again, whole, after reconnect.
+type streamWriter struct {
+	network    string
+	address    string
+	tlsconf    *tls.Config // nil for plain connections.
+	tlsca      string
+	tlscert    string
+	tlskey     string
+	maxbackoff time.Duration
+	spooldir   string
+	spoolsize  int64
+	dropped    uint64 // atomic
+
+	mu      sync.Mutex
+	conn    net.Conn // nil while disconnected or replaying.
+	pending net.Conn // replaying spool, refer replay().
+	spool   *spool   // nil if not configured.
+	closed  bool
+	closech chan struct{} // stop reconnecting.
+}
+
+// newStreamWriter reading "log.sinks.<name>.network", "address",
+// "tls", "tlsca", "tlscert", "tlskey", "tlsservername", "spool",
+// "spoolsize" and "maxbackoff" from validated setts. Collector is
+// dialed in the background, records are spooled until it is connected.
+func newStreamWriter(
+	name string, setts map[string]interface{}) (*streamWriter, error) {
+
+	key := "log.sinks." + name + "."
+	w := &streamWriter{
+		network: "tcp", maxbackoff: streammaxbackoff, spoolsize: 64 << 20,
+		closech: make(chan struct{}),
+	}
+	if network, _ := settingstring(setts, key+"network"); network != "" {
+		w.network = strings.ToLower(network)
+	}
+	w.address, _ = settingstring(setts, key+"address")
+	if maxbackoff, _ := settingduration(setts, key+"maxbackoff"); maxbackoff > 0 {
+		w.maxbackoff = maxbackoff
+	}
+	if spoolsize, _ := settingsize(setts, key+"spoolsize"); spoolsize > 0 {
+		w.spoolsize = spoolsize
+	}
+	var err error
+	if w.tlsconf, err = w.loadtls(setts, key); err != nil {
+		return nil, err
+	}
+	if w.spooldir, _ = settingstring(setts, key+"spool"); w.spooldir != "" {
+		if w.spool, err = openspool(w.spooldir, w.spoolsize); err != nil {
+			return nil, err
+		}
+	}
+
+	go w.reconnect()
+	return w, nil
+}
+
+// loadtls return TLS configuration, nil if none of "tls", "tlsca",
+// "tlscert" or "tlskey" are configured.
+func (w *streamWriter) loadtls(
+	setts map[string]interface{}, key string) (*tls.Config, error) {
+
+	enable, _ := settingbool(setts, key+"tls")
+	w.tlsca, _ = settingstring(setts, key+"tlsca")
+	w.tlscert, _ = settingstring(setts, key+"tlscert")
+	w.tlskey, _ = settingstring(setts, key+"tlskey")
+	if !enable && w.tlsca == "" && w.tlscert == "" && w.tlskey == "" {
+		return nil, nil
+	}
+
+	conf := &tls.Config{}
+	if conf.ServerName, _ = settingstring(setts, key+"tlsservername"); conf.ServerName == "" {
+		conf.ServerName, _, _ = net.SplitHostPort(w.address)
+	}
+	if w.tlsca != "" {
+		pem, err := os.ReadFile(w.tlsca)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %q", w.tlsca)
+		}
+	}
+	if w.tlscert != "" {
+		cert, err := tls.LoadX509KeyPair(w.tlscert, w.tlskey)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// dial the collector, conn is nil on error.
+func (w *streamWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: streamdialtimeout}
+	if w.tlsconf == nil {
+		return dialer.Dial(w.network, w.address)
+	}
+	conn, err := tls.DialWithDialer(dialer, w.network, w.address, w.tlsconf)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// reconnect with exponential backoff until a connection is attached,
+// or w is closed.
+func (w *streamWriter) reconnect() {
+	backoff := streambackoff
+	for {
+		if conn, err := w.dial(); err == nil && w.replay(conn) == nil {
+			return
+		}
+		select {
+		case <-w.closech:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > w.maxbackoff {
+			backoff = w.maxbackoff
+		}
+	}
+}
+
+// replay spooled records on conn, in batches, and attach conn once the
+// spool is drained. mu is released while a batch is sent, such that
+// writers are not held up, their records are spooled meanwhile.
+func (w *streamWriter) replay(conn net.Conn) error {
+	for {
+		w.mu.Lock()
+		if w.closed {
+			w.mu.Unlock()
+			conn.Close()
+			return os.ErrClosed
+		}
+		var seg *spoolseg
+		var batch []byte
+		var err error
+		if w.spool != nil {
+			seg, batch, err = w.spool.next(streambatch)
+		}
+		if err != nil { // unreadable segment, skip it.
+			atomic.AddUint64(&w.dropped, uint64(seg.count))
+			w.spool.remove()
+			w.mu.Unlock()
+			continue
+		} else if seg == nil {
+			w.conn, w.pending = conn, nil
+			w.mu.Unlock()
+			return nil
+		}
+		w.pending = conn
+		w.mu.Unlock()
+
+		n, err := send(conn, batch)
+
+		w.mu.Lock()
+		w.spool.advance(seg, batch[:n])
+		w.pending = nil
+		w.mu.Unlock()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+}
+
+// Write implement io.Writer, p shall be one or more complete records.
+// If the connection fails, records in p not completely sent are
+// spooled and reconnect is kicked off.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	size := len(p)
+	if w.conn != nil {
+		if !connclosed(w.conn) {
+			n, err := send(w.conn, p)
+			if err == nil {
+				return len(p), nil
+			}
+			p = p[bytes.LastIndexByte(p[:n], '\n')+1:]
+		}
+		w.conn.Close()
+		w.conn = nil
+		if !w.closed {
+			go w.reconnect()
+		}
+	}
+	if w.spool == nil || w.closed {
+		atomic.AddUint64(&w.dropped, uint64(bytes.Count(p, []byte{'\n'})))
+		return 0, errStreamDown
+	}
+	dropped, err := w.spool.append(p)
+	if err != nil {
+		dropped += bytes.Count(p, []byte{'\n'})
+	}
+	atomic.AddUint64(&w.dropped, uint64(dropped))
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func send(conn net.Conn, p []byte) (int, error) {
+	conn.SetWriteDeadline(time.Now().Add(streamwritetimeout))
+	return conn.Write(p)
+}
+
+// Dropped return the number of records dropped while disconnected,
+// because spool is not configured or it is full.
+func (w *streamWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close the connection and spool, spooled records are replayed by the
+// next writer opened on the same spool directory.
+func (w *streamWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.closech)
+	var err error
+	if w.conn != nil {
+		err = w.conn.Close()
+		w.conn = nil
+	}
+	if w.pending != nil { // abort replay.
+		w.pending.Close()
+	}
+	if w.spool != nil {
+		if serr := w.spool.close(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// settings add stream parameters of sink key to setts.
+func (w *streamWriter) settings(setts map[string]interface{}, key string) {
+	setts[key+"network"], setts[key+"address"] = w.network, w.address
+	setts[key+"tls"] = w.tlsconf != nil
+	setts[key+"tlsca"], setts[key+"tlscert"] = w.tlsca, w.tlscert
+	setts[key+"tlskey"], setts[key+"tlsservername"] = w.tlskey, ""
+	if w.tlsconf != nil {
+		setts[key+"tlsservername"] = w.tlsconf.ServerName
+	}
+	setts[key+"spool"], setts[key+"spoolsize"] = w.spooldir, w.spoolsize
+	setts[key+"maxbackoff"] = w.maxbackoff.String()
+}
+
+// spool is a directory of segment files, named by an increasing
+// sequence number, holding records in the order they were written.
+// Once total size would exceed maxsize, oldest segments are removed.
+type spool struct {
+	dir     string
+	maxsize int64
+	segsize int64 // start a new segment beyond this size.
+	segs    []*spoolseg
+	size    int64
+	seq     uint64
+	fd      *os.File // last segment, open for append.
+}
+
+type spoolseg struct {
+	name   string
+	size   int64
+	count  int   // records in segment, not yet replayed.
+	offset int64 // replayed upto offset.
+}
+
+// openspool in dir, segments left by a previous run are retained for
+// replay, trimming partial records left by a crash.
+func openspool(dir string, maxsize int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &spool{dir: dir, maxsize: maxsize, segsize: maxsize / 8}
+	if s.segsize < 1 {
+		s.segsize = 1
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+spoolext))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		base := strings.TrimSuffix(filepath.Base(name), spoolext)
+		seq, err := strconv.ParseUint(base, 10, 64)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if n := bytes.LastIndexByte(data, '\n') + 1; n < len(data) {
+			data = data[:n]
+			if err := os.Truncate(name, int64(n)); err != nil {
+				return nil, err
+			}
+		}
+		if len(data) == 0 {
+			os.Remove(name)
+			continue
+		}
+		seg := &spoolseg{
+			name: name, size: int64(len(data)),
+			count: bytes.Count(data, []byte{'\n'}),
+		}
+		s.segs, s.size, s.seq = append(s.segs, seg), s.size+seg.size, seq
+	}
+	return s, nil
+}
+
+// append records in p, removing oldest segments to stay within
+// maxsize. Return the number of records removed.
+func (s *spool) append(p []byte) (int, error) {
+	if int64(len(p)) > s.maxsize {
+		return 0, fmt.Errorf("record larger than spool size %v", s.maxsize)
+	}
+	dropped := 0
+	for s.size+int64(len(p)) > s.maxsize {
+		dropped += s.segs[0].count
+		if err := s.remove(); err != nil {
+			return dropped, err
+		}
+	}
+	if s.fd == nil || s.segs[len(s.segs)-1].size >= s.segsize {
+		if err := s.newsegment(); err != nil {
+			return dropped, err
+		}
+	}
+	seg := s.segs[len(s.segs)-1]
+	n, err := s.fd.Write(p)
+	seg.size, s.size = seg.size+int64(n), s.size+int64(n)
+	if err != nil {
+		return dropped, err
+	}
+	seg.count += bytes.Count(p, []byte{'\n'})
+	return dropped, nil
+}
+
+func (s *spool) newsegment() error {
+	if s.fd != nil {
+		s.fd.Close()
+		s.fd = nil
+	}
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d%v", s.seq, spoolext))
+	fd, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.fd = fd
+	s.segs = append(s.segs, &spoolseg{name: name})
+	return nil
+}
+
+// next return complete records from the oldest segment, starting at
+// its replay offset, upto about size bytes. Return nil segment if
+// spool is empty, on error the segment that could not be read.
+func (s *spool) next(size int) (*spoolseg, []byte, error) {
+	for len(s.segs) > 0 {
+		seg := s.segs[0]
+		if seg.offset >= seg.size {
+			s.remove()
+			continue
+		}
+		fd, err := os.Open(seg.name)
+		if err != nil {
+			return seg, nil, err
+		}
+		defer fd.Close()
+		avail := seg.size - seg.offset
+		for n := int64(size); ; n *= 2 { // grow for records beyond size.
+			if n > avail {
+				n = avail
+			}
+			buf := make([]byte, n)
+			if m, err := fd.ReadAt(buf, seg.offset); m < len(buf) {
+				return seg, nil, err
+			}
+			if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+				return seg, buf[:i+1], nil
+			} else if n == avail {
+				return seg, buf, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// advance seg past replayed records in done, partial records are left
+// for the next replay. seg is removed once fully replayed. A no-op if
+// seg was already removed to stay within maxsize.
+func (s *spool) advance(seg *spoolseg, done []byte) error {
+	if len(s.segs) == 0 || s.segs[0] != seg {
+		return nil
+	}
+	done = done[:bytes.LastIndexByte(done, '\n')+1]
+	seg.offset += int64(len(done))
+	seg.count -= bytes.Count(done, []byte{'\n'})
+	if seg.offset >= seg.size {
+		return s.remove()
+	}
+	return nil
+}
+
+// remove oldest segment.
+func (s *spool) remove() error {
+	seg := s.segs[0]
+	if len(s.segs) == 1 && s.fd != nil {
+		s.fd.Close()
+		s.fd = nil
+	}
+	s.segs, s.size = s.segs[1:], s.size-seg.size
+	return os.Remove(seg.name)
+}
+
+func (s *spool) close() error {
+	if s.fd == nil {
+		return nil
+	}
+	err := s.fd.Close()
+	s.fd = nil
+	return err
+}
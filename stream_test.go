@@ -0,0 +1,400 @@
+package log
+
+import "os"
+import "net"
+import "sync"
+import "time"
+import "bufio"
+import "bytes"
+import "strings"
+import "testing"
+import "math/big"
+import "crypto/tls"
+import "crypto/rand"
+import "crypto/x509"
+import "crypto/ecdsa"
+import "crypto/elliptic"
+import "encoding/pem"
+import "encoding/json"
+import "path/filepath"
+import "crypto/x509/pkix"
+
+// collector accept connections on ln and send received records to
+// the returned channel, until stopped.
+func collector(
+	t *testing.T, ln net.Listener) (chan map[string]interface{}, func()) {
+
+	recs := make(chan map[string]interface{}, 100)
+	var mu sync.Mutex
+	conns := []net.Conn{}
+	stop := func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					rec := map[string]interface{}{}
+					if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+						t.Errorf("%v in %q", err, scanner.Text())
+					}
+					recs <- rec
+				}
+			}()
+		}
+	}()
+	return recs, stop
+}
+
+// streamconnected return whether every stream sink of logger is
+// connected to its collector.
+func streamconnected(logger Logger) func() bool {
+	return func() bool {
+		for _, s := range logger.(*defaultLogger).sinks {
+			if w, ok := s.writer().(*streamWriter); ok {
+				w.mu.Lock()
+				conn := w.conn
+				w.mu.Unlock()
+				if conn == nil {
+					return false
+				}
+			}
+		}
+		return true
+	}
+}
+
+func recvmsgs(t *testing.T, recs chan map[string]interface{}, n int) []string {
+	msgs := []string{}
+	for len(msgs) < n {
+		select {
+		case rec := <-recs:
+			msgs = append(msgs, rec["msg"].(string))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v, expected %v records", msgs, n)
+		}
+	}
+	return msgs
+}
+
+func TestStream(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, stop := collector(t, ln)
+	defer stop()
+
+	setts := map[string]interface{}{
+		"log.sinks":                "fluent",
+		"log.sinks.fluent.writer":  "stream",
+		"log.sinks.fluent.address": ln.Addr().String(),
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	waitfor(t, streamconnected(logger))
+
+	logger.Infow("first\nline", "req", 7)
+	logger.Warnf("second")
+	if msgs := recvmsgs(t, recs, 2); msgs[0] != "first\nline" || msgs[1] != "second" {
+		t.Errorf("unexpected %q", msgs)
+	}
+
+	setts = logger.(*defaultLogger).Settings()
+	refs := map[string]interface{}{
+		"log.sinks.fluent.writer": "stream", "log.sinks.fluent.format": "json",
+		"log.sinks.fluent.network": "tcp", "log.sinks.fluent.tls": false,
+		"log.sinks.fluent.maxbackoff": "30s",
+	}
+	for key, ref := range refs {
+		if setts[key] != ref {
+			t.Errorf("%v expected %v, got %v", key, ref, setts[key])
+		}
+	}
+}
+
+func TestStreamSpool(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, spooldir := filepath.Join(dir, "collector"), filepath.Join(dir, "spool")
+
+	setts := map[string]interface{}{
+		"log.sinks":                   "fluent",
+		"log.sinks.fluent.writer":     "stream",
+		"log.sinks.fluent.network":    "unix",
+		"log.sinks.fluent.address":    path,
+		"log.sinks.fluent.spool":      spooldir,
+		"log.sinks.fluent.maxbackoff": "20ms",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	// collector is down, records are spooled.
+	for _, msg := range []string{"one", "two", "three"} {
+		logger.Infof("%v", msg)
+	}
+	if names, _ := filepath.Glob(filepath.Join(spooldir, "*.spool")); len(names) == 0 {
+		t.Errorf("expected spool files")
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	recs, stop := collector(t, ln)
+	defer stop()
+	logger.Infof("four")
+	msgs := recvmsgs(t, recs, 4)
+	if s := strings.Join(msgs, ","); s != "one,two,three,four" {
+		t.Errorf("unexpected %v", s)
+	}
+	if names, _ := filepath.Glob(filepath.Join(spooldir, "*.spool")); len(names) != 0 {
+		t.Errorf("unexpected %v", names)
+	}
+	if n := logger.(*defaultLogger).Dropped(); n != 0 {
+		t.Errorf("unexpected %v", n)
+	}
+}
+
+func TestStreamCollectorRestart(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	recs, stop := collector(t, ln)
+	defer func() { stop() }()
+
+	setts := map[string]interface{}{
+		"log.sinks":                   "fluent",
+		"log.sinks.fluent.writer":     "stream",
+		"log.sinks.fluent.address":    address,
+		"log.sinks.fluent.spool":      t.TempDir(),
+		"log.sinks.fluent.maxbackoff": "20ms",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	waitfor(t, streamconnected(logger))
+	logger.Infof("one")
+	recvmsgs(t, recs, 1)
+
+	// collector dies after the connection is up.
+	stop()
+	w := logger.(*defaultLogger).sinks[0].writer().(*streamWriter)
+	waitfor(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return connclosed(w.conn)
+	})
+	logger.Infof("two")
+	logger.Infof("three")
+
+	if ln, err = net.Listen("tcp", address); err != nil {
+		t.Skip(err)
+	}
+	recs, stop = collector(t, ln)
+	logger.Infof("four")
+	if msgs := recvmsgs(t, recs, 3); strings.Join(msgs, ",") != "two,three,four" {
+		t.Errorf("unexpected %v", msgs)
+	}
+	if n := logger.(*defaultLogger).Dropped(); n != 0 {
+		t.Errorf("unexpected %v", n)
+	}
+}
+
+func TestSpoolCap(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := openspool(dir, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped := 0
+	for i := 0; i < 10; i++ {
+		line := []byte(strings.Repeat(string(rune('a'+i)), 49) + "\n")
+		n, err := s.append(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped += n
+	}
+	if dropped != 2 || s.size != 400 {
+		t.Errorf("unexpected %v %v", dropped, s.size)
+	}
+	if _, err := s.append(make([]byte, 401)); err == nil {
+		t.Errorf("expected error")
+	}
+	s.close()
+
+	// reopen, trimming a partial record.
+	last := s.segs[len(s.segs)-1].name
+	fd, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Write([]byte("partial"))
+	fd.Close()
+	if s, err = openspool(dir, 400); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for {
+		seg, batch, err := s.next(100)
+		if err != nil {
+			t.Fatal(err)
+		} else if seg == nil {
+			break
+		}
+		buf.Write(batch)
+		s.advance(seg, batch)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 8 || lines[0][0] != 'c' || lines[7][0] != 'j' {
+		t.Errorf("unexpected %q", lines)
+	}
+	if len(s.segs) != 0 || s.size != 0 {
+		t.Errorf("unexpected %v %v", s.segs, s.size)
+	}
+}
+
+func TestStreamTLS(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certfile, keyfile := selfsigned(t, dir)
+	cert, err := tls.LoadX509KeyPair(certfile, keyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, stop := collector(t, ln)
+	defer stop()
+
+	setts := map[string]interface{}{
+		"log.sinks":                      "fluent",
+		"log.sinks.fluent.writer":        "stream",
+		"log.sinks.fluent.address":       ln.Addr().String(),
+		"log.sinks.fluent.tlsca":         certfile,
+		"log.sinks.fluent.tlsservername": "localhost",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	waitfor(t, streamconnected(logger))
+
+	logger.Errorf("secure")
+	if msgs := recvmsgs(t, recs, 1); msgs[0] != "secure" {
+		t.Errorf("unexpected %q", msgs)
+	}
+	if tlsok := logger.(*defaultLogger).Settings()["log.sinks.fluent.tls"]; tlsok != true {
+		t.Errorf("unexpected %v", tlsok)
+	}
+}
+
+// selfsigned create certificate and key files for localhost in dir.
+func selfsigned(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certfile, keyfile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certpem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keypem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyder})
+	if err := os.WriteFile(certfile, certpem, 0644); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(keyfile, keypem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certfile, keyfile
+}
+
+func TestStreamConfig(t *testing.T) {
+	testcases := []map[string]interface{}{
+		{"log.sinks": "a", "log.sinks.a.writer": "stream"},
+		{
+			"log.sinks": "a", "log.sinks.a.writer": "stream",
+			"log.sinks.a.address": "localhost:24224", "log.sinks.a.network": "udp",
+		},
+		{
+			"log.sinks": "a", "log.sinks.a.writer": "stream",
+			"log.sinks.a.address": "localhost:24224", "log.sinks.a.format": "text",
+		},
+		{
+			"log.sinks": "a", "log.sinks.a.writer": "stream",
+			"log.sinks.a.address": "localhost:24224", "log.sinks.a.tlscert": "a.pem",
+		},
+		{
+			"log.sinks": "a", "log.sinks.a.writer": "stream",
+			"log.sinks.a.address": "localhost:24224", "log.sinks.a.spoolsize": "1XB",
+		},
+		{
+			"log.sinks": "a", "log.sinks.a.writer": "stream",
+			"log.sinks.a.address": "/run/vector.sock", "log.sinks.a.network": "unix",
+			"log.sinks.a.tls": true,
+		},
+		{"log.sinks": "a", "log.sinks.a.writer": "stderr", "log.sinks.a.spool": "/tmp"},
+	}
+	for _, setts := range testcases {
+		if err := validate(setts); err == nil {
+			t.Errorf("expected error for %v", setts)
+		}
+	}
+}
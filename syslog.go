@@ -0,0 +1,337 @@
+package log
+
+import "os"
+import "fmt"
+import "net"
+import "sync"
+import "time"
+import "strconv"
+import "strings"
+import "path/filepath"
+
+// Log levels are mapped to syslog severities as,
+//
+//	golog     syslog
+//	fatal     crit    (2)
+//	error     err     (3)
+//	warn      warning (4)
+//	info      info    (6)
+//	verbose   debug   (7)
+//	debug     debug   (7)
+//	trace     debug   (7)
+//
+// Ignore level is never logged. Severities emerg, alert and notice
+// are not used.
+
+// SyslogSeverity return syslog severity for golog level, refer
+// mapping above.
+func SyslogSeverity(level LogLevel) int {
+	switch level {
+	case LogLevelIgnore, LogLevelFatal:
+		return 2
+	case LogLevelError:
+		return 3
+	case LogLevelWarn:
+		return 4
+	case LogLevelInfo:
+		return 6
+	}
+	return 7
+}
+
+// sdid for RFC 5424 structured data carrying record fields, 32473 is
+// the private enterprise number reserved for documentation.
+const sdid = "golog@32473"
+
+// syslogpaths for local syslog daemon.
+var syslogpaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogWriter send records to a syslog daemon, one message per
+// Write, reconnecting once if a write fails. Records are encoded by
+// encoderecord() in RFC 5424 or RFC 3164 format.
+type syslogWriter struct {
+	network  string // empty for local syslog.
+	address  string
+	facility int
+	appname  string
+	protocol string // "rfc5424" or "rfc3164"
+	hostname string
+	pid      string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	framing string // "", "octet" or "newline", for stream sockets.
+}
+
+// newSyslogWriter reading "log.sinks.<name>.network", "address",
+// "facility", "appname" and "protocol" from validated setts, and
+// connect to syslog daemon.
+func newSyslogWriter(
+	name string, setts map[string]interface{}) (*syslogWriter, error) {
+
+	key := "log.sinks." + name + "."
+	w := &syslogWriter{facility: 1, pid: strconv.Itoa(os.Getpid())}
+	w.network, _ = settingstring(setts, key+"network")
+	w.address, _ = settingstring(setts, key+"address")
+	w.network = strings.ToLower(w.network)
+	if facility, _ := settingstring(setts, key+"facility"); facility != "" {
+		w.facility, _ = string2facility(facility)
+	}
+	if w.appname, _ = settingstring(setts, key+"appname"); w.appname == "" {
+		w.appname = filepath.Base(os.Args[0])
+	}
+	protocol, _ := settingstring(setts, key+"protocol")
+	w.protocol, _ = string2protocol(protocol)
+	if w.hostname, _ = os.Hostname(); w.hostname == "" {
+		w.hostname = "-"
+	}
+
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect shall be called with mu locked, or before w is shared.
+func (w *syslogWriter) connect() (err error) {
+	if w.network != "" {
+		w.conn, err = net.Dial(w.network, w.address)
+		if err != nil {
+			return err
+		}
+		switch w.network {
+		case "tcp", "tcp4", "tcp6":
+			w.framing = "octet"
+		case "unix":
+			w.framing = "newline"
+		default:
+			w.framing = ""
+		}
+		return nil
+	}
+	paths := syslogpaths
+	if w.address != "" {
+		paths = []string{w.address}
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range paths {
+			if w.conn, err = net.Dial(network, path); err == nil {
+				w.framing = ""
+				if network == "unix" {
+					w.framing = "newline"
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("syslog delivery error: %v", err)
+}
+
+// Write implement io.Writer, p is sent as a single syslog message.
+// Stream connections closed by the daemon, say on restart, are
+// detected before writing, refer connclosed().
+func (w *syslogWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil && w.framing != "" && connclosed(w.conn) {
+		w.conn.Close()
+		w.conn = nil
+	}
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				return 0, err
+			}
+		}
+		if err = w.send(p); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+func (w *syslogWriter) send(p []byte) (err error) {
+	switch w.framing {
+	case "octet": // RFC 6587 octet counting.
+		msg := strconv.AppendInt(make([]byte, 0, len(p)+8), int64(len(p)), 10)
+		_, err = w.conn.Write(append(append(msg, ' '), p...))
+	case "newline": // escape newlines, as rsyslog does, to keep p whole.
+		msg := make([]byte, 0, len(p)+1)
+		for _, c := range p {
+			if c == '\n' {
+				msg = append(msg, "#012"...)
+			} else {
+				msg = append(msg, c)
+			}
+		}
+		_, err = w.conn.Write(append(msg, '\n'))
+	default:
+		_, err = w.conn.Write(p)
+	}
+	return err
+}
+
+// Close the connection to syslog daemon.
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// encoderecord as syslog message, without trailing newline.
+func (w *syslogWriter) encoderecord(r *record) []byte {
+	pri := w.facility*8 + SyslogSeverity(r.level)
+	out := append(make([]byte, 0, 256), '<')
+	out = append(strconv.AppendInt(out, int64(pri), 10), '>')
+
+	if w.protocol == "rfc3164" {
+		out = append(out, r.when.Format(time.Stamp)...)
+		if w.network != "" { // local daemons add hostname.
+			out = append(append(out, ' '), w.hostname...)
+		}
+		out = append(append(out, ' '), w.appname...)
+		out = append(append(append(out, '['), w.pid...), "]: "...)
+		if r.name != "" {
+			out = append(append(out, r.name...), ": "...)
+		}
+		return appendfields(append(out, r.msg...), r.fields)
+	}
+
+	out = append(out, "1 "...)
+	out = append(out, r.when.Format("2006-01-02T15:04:05.000000Z07:00")...)
+	out = append(append(out, ' '), sysloghdr(w.hostname, 255)...)
+	out = append(append(out, ' '), sysloghdr(w.appname, 48)...)
+	out = append(append(out, ' '), w.pid...)
+	out = append(append(out, ' '), sysloghdr(r.name, 32)...)
+	out = append(out, ' ')
+	if len(r.fields) == 0 {
+		out = append(out, '-')
+	} else {
+		out = append(append(out, '['), sdid...)
+		for _, field := range r.fields {
+			out = append(out, ' ')
+			out = appendsdname(out, field.Key)
+			out = append(out, `="`...)
+			out = appendsdvalue(out, fmt.Sprintf("%v", field.Value))
+			out = append(out, '"')
+		}
+		out = append(out, ']')
+	}
+	if r.msg != "" {
+		out = append(append(out, ' '), r.msg...)
+	}
+	return out
+}
+
+// settings add syslog parameters of sink key to setts.
+func (w *syslogWriter) settings(setts map[string]interface{}, key string) {
+	setts[key+"network"], setts[key+"address"] = w.network, w.address
+	setts[key+"facility"] = facilities[w.facility]
+	setts[key+"appname"], setts[key+"protocol"] = w.appname, w.protocol
+}
+
+// sysloghdr return s as RFC 5424 header field, printable US-ASCII
+// upto n characters, "-" if empty.
+func sysloghdr(s string, n int) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(out) < n; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		return "-"
+	}
+	return string(out)
+}
+
+// appendsdname replaces characters that cannot be part of an
+// SD-PARAM name with '_', name is truncated to 32 characters.
+func appendsdname(out []byte, name string) []byte {
+	if name == "" {
+		return append(out, '_')
+	}
+	for i := 0; i < len(name) && i < 32; i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// appendsdvalue escape '"', '\' and ']' in SD-PARAM value.
+func appendsdvalue(out []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == '"' || c == '\\' || c == ']' {
+			out = append(out, '\\')
+		}
+		out = append(out, value[i])
+	}
+	return out
+}
+
+var facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console",
+	"solaris-cron", "local0", "local1", "local2", "local3", "local4",
+	"local5", "local6", "local7",
+}
+
+func string2facility(s string) (int, error) {
+	s = strings.ToLower(s)
+	for i, facility := range facilities {
+		if s == facility {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unexpected facility %q", s)
+}
+
+func string2protocol(s string) (string, error) {
+	switch s = strings.ToLower(s); s {
+	case "", "rfc5424", "5424":
+		return "rfc5424", nil
+	case "rfc3164", "3164":
+		return "rfc3164", nil
+	}
+	return "", fmt.Errorf("unexpected syslog protocol %q", s)
+}
+
+func checkfacility(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		if s == "" {
+			return nil
+		}
+		_, err := string2facility(s)
+		return err
+	})
+}
+
+func checkprotocol(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		_, err := string2protocol(s)
+		return err
+	})
+}
+
+func checknetwork(setts map[string]interface{}, key string) error {
+	return checkstringwith(setts, key, func(s string) error {
+		switch strings.ToLower(s) {
+		case "", "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix",
+			"unixgram":
+			return nil
+		}
+		return fmt.Errorf("unexpected network %q", s)
+	})
+}
@@ -0,0 +1,238 @@
+package log
+
+import "io"
+import "os"
+import "net"
+import "bufio"
+import "regexp"
+import "strconv"
+import "strings"
+import "testing"
+import "time"
+import "path/filepath"
+
+func TestSyslogSeverity(t *testing.T) {
+	refs := map[LogLevel]int{
+		LogLevelFatal: 2, LogLevelError: 3, LogLevelWarn: 4, LogLevelInfo: 6,
+		LogLevelVerbose: 7, LogLevelDebug: 7, LogLevelTrace: 7,
+	}
+	for level, ref := range refs {
+		if severity := SyslogSeverity(level); severity != ref {
+			t.Errorf("%v expected %v, got %v", level, ref, severity)
+		}
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+
+	setts := map[string]interface{}{
+		"log.level":                 "debug",
+		"log.sinks":                 "syslog",
+		"log.sinks.syslog.writer":   "syslog",
+		"log.sinks.syslog.address":  path,
+		"log.sinks.syslog.facility": "local3",
+		"log.sinks.syslog.appname":  "myapp",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.(*defaultLogger).Named("storage").With("req", 7).Warnw("slow", "path", `a "b"]`)
+	logger.Debugf("replay %v", 1)
+
+	pid := strconv.Itoa(os.Getpid())
+	refs := []string{
+		`^<156>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) \S+ myapp ` +
+			pid + ` storage \[golog@32473 req="7" path="a \\"b\\"\\]"\] slow$`,
+		`^<159>1 \S+ \S+ myapp ` + pid + ` - - replay 1$`,
+	}
+	buf := make([]byte, 1024)
+	for _, ref := range refs {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := string(buf[:n]); !regexp.MustCompile(ref).MatchString(msg) {
+			t.Errorf("expected %v, got %q", ref, msg)
+		}
+	}
+
+	setts = logger.(*defaultLogger).Settings()
+	if s := setts["log.sinks.syslog.facility"]; s != "local3" {
+		t.Errorf("unexpected %v", s)
+	} else if s := setts["log.sinks.syslog.protocol"]; s != "rfc5424" {
+		t.Errorf("unexpected %v", s)
+	}
+}
+
+func TestSyslogUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	setts := map[string]interface{}{
+		"log.sinks":                "syslog",
+		"log.sinks.syslog.writer":  "syslog",
+		"log.sinks.syslog.network": "unix",
+		"log.sinks.syslog.address": path,
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// newline framing, embedded newlines shall not split the message.
+	logger.Infof("first\nline")
+	logger.Infof("second")
+	r := bufio.NewReader(conn)
+	for _, ref := range []string{" - first#012line\n", " - second\n"} {
+		if msg, err := r.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		} else if !strings.HasPrefix(msg, "<14>1 ") || !strings.HasSuffix(msg, ref) {
+			t.Errorf("expected suffix %q, got %q", ref, msg)
+		}
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	setts := map[string]interface{}{
+		"log.sinks":                 "syslog",
+		"log.sinks.syslog.writer":   "syslog",
+		"log.sinks.syslog.network":  "udp",
+		"log.sinks.syslog.address":  conn.LocalAddr().String(),
+		"log.sinks.syslog.appname":  "myapp",
+		"log.sinks.syslog.protocol": "rfc3164",
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Errorw("disk full", "dev", "sda")
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := `^<11>[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d \S+ myapp\[` +
+		strconv.Itoa(os.Getpid()) + `\]: disk full dev=sda$`
+	if msg := string(buf[:n]); !regexp.MustCompile(ref).MatchString(msg) {
+		t.Errorf("expected %v, got %q", ref, msg)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	setts := map[string]interface{}{
+		"log.sinks":                "syslog",
+		"log.sinks.syslog.writer":  "syslog",
+		"log.sinks.syslog.network": "tcp",
+		"log.sinks.syslog.address": ln.Addr().String(),
+	}
+	logger, err := New(nil, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	// RFC 6587 octet counting.
+	readmsg := func(r *bufio.Reader) string {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		return string(msg)
+	}
+
+	conn := <-conns
+	logger.Infof("first\nline")
+	if msg := readmsg(bufio.NewReader(conn)); !strings.HasSuffix(msg, " - first\nline") {
+		t.Errorf("unexpected %q", msg)
+	}
+
+	// daemon restart, logger reconnects without losing the record.
+	conn.Close()
+	w := logger.(*defaultLogger).sinks[0].writer().(*syslogWriter)
+	waitfor(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return connclosed(w.conn)
+	})
+	logger.Infof("second")
+	select {
+	case conn = <-conns:
+		defer conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected reconnect")
+	}
+	msg := readmsg(bufio.NewReader(conn))
+	if !strings.HasPrefix(msg, "<14>1 ") || !strings.HasSuffix(msg, " - second") {
+		t.Errorf("unexpected %q", msg)
+	}
+}
+
+func TestSyslogConfig(t *testing.T) {
+	testcases := []map[string]interface{}{
+		{"log.sinks": "a", "log.sinks.a.writer": "syslog", "log.sinks.a.facility": "local9"},
+		{"log.sinks": "a", "log.sinks.a.writer": "syslog", "log.sinks.a.protocol": "rfc1"},
+		{"log.sinks": "a", "log.sinks.a.writer": "syslog", "log.sinks.a.network": "sctp"},
+		{"log.sinks": "a", "log.sinks.a.writer": "stderr", "log.sinks.a.facility": "user"},
+	}
+	for _, setts := range testcases {
+		if err := validate(setts); err == nil {
+			t.Errorf("expected error for %v", setts)
+		}
+	}
+}
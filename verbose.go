@@ -0,0 +1,194 @@
+package log
+
+import "fmt"
+import "path"
+import "sync"
+import "strconv"
+import "strings"
+import "runtime"
+
+// Verbose is returned by V(), its methods log only if verbosity was
+// enabled for the call site.
+type Verbose struct {
+	logger Logger // nil if disabled.
+	level  LogLevel
+}
+
+// V return a Verbose that logs if n is within the verbosity of the
+// caller's source file, similar to glog's V(). Verbosity is the
+// maximum of "log.v", "log.vmodule" rule matching the caller's file,
+// and the verbosity implied by "log.level": 1 for verbose, 2 for
+// debug and unlimited for trace. Records are logged at verbose level
+// for V(1), debug level for V(2) and trace level beyond that. V(0)
+// is same as logging at info level.
+//
+//	if log.V(2).Enabled() {
+//		log.V(2).Infof("dump %v", expensive())
+//	}
+//
+// With "log.vmodule" configured, caller's file is matched once per call
+// site and cached, otherwise V is a couple of loads and a compare.
+func V(n int) Verbose {
+	logger, level := getlog(), vlevel(n)
+	l, ok := logger.(*defaultLogger)
+	if !ok || n <= 0 {
+		if logger.Enabled(level) {
+			return Verbose{logger: logger, level: level}
+		}
+		return Verbose{}
+	}
+	cfg := l.config()
+	if n <= cfg.v || n <= levelverbosity(l.loglevel()) {
+		return Verbose{logger: l, level: level}
+	} else if cfg.vmodule == nil {
+		return Verbose{}
+	}
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	if n <= cfg.vmodule.verbosity(pcs[0]) {
+		return Verbose{logger: l, level: level}
+	}
+	return Verbose{}
+}
+
+// Enabled return whether records logged using v will be written.
+func (v Verbose) Enabled() bool {
+	return v.logger != nil
+}
+
+// Infof log formatted message if v is enabled.
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v.logger == nil {
+		return
+	} else if l, ok := v.logger.(*defaultLogger); ok {
+		l.printv(v.level, fmt.Sprintf(trimformat(format), args...), nil)
+		return
+	}
+	v.logger.Printlf(v.level, format, args...)
+}
+
+// Infow log msg followed by key/value fields if v is enabled.
+func (v Verbose) Infow(msg string, keyvals ...interface{}) {
+	if v.logger == nil {
+		return
+	} else if l, ok := v.logger.(*defaultLogger); ok {
+		l.printv(v.level, trimformat(msg), kv2fields(nil, keyvals))
+		return
+	}
+	v.logger.Printlw(v.level, msg, keyvals...)
+}
+
+// printv skip level check, verbosity is already checked by V().
+func (l *defaultLogger) printv(level LogLevel, msg string, fields []Field) {
+	l.output(level, msg, fields)
+}
+
+func vlevel(n int) LogLevel {
+	switch {
+	case n <= 0:
+		return LogLevelInfo
+	case n == 1:
+		return LogLevelVerbose
+	case n == 2:
+		return LogLevelDebug
+	}
+	return LogLevelTrace
+}
+
+func levelverbosity(level LogLevel) int {
+	switch level {
+	case LogLevelVerbose:
+		return 1
+	case LogLevelDebug:
+		return 2
+	case LogLevelTrace:
+		return int(^uint(0) >> 1)
+	}
+	return 0
+}
+
+// vmodule rules from "log.vmodule", with verbosity cached by program
+// counter. A new vmodule is created whenever rules change, hence the
+// cache is never stale.
+type vmodule struct {
+	rules []vrule
+	cache sync.Map // uintptr -> int
+}
+
+type vrule struct {
+	pattern string
+	v       int
+}
+
+// parsevmodule parse list of pattern=N. Patterns without "/" are
+// matched with file name, patterns with "/" are matched with as many
+// trailing path components, in both cases without ".go" extension.
+// Patterns follow path.Match() syntax, first matching rule wins.
+func parsevmodule(items []string) (*vmodule, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	m := &vmodule{}
+	for _, item := range items {
+		pattern, value, ok := strings.Cut(item, "=")
+		if pattern = strings.TrimSpace(pattern); !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid vmodule rule %q", item)
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid vmodule pattern %q", pattern)
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid vmodule verbosity %q", item)
+		}
+		m.rules = append(m.rules, vrule{pattern: pattern, v: v})
+	}
+	return m, nil
+}
+
+// verbosity for the call site at pc.
+func (m *vmodule) verbosity(pc uintptr) int {
+	if v, ok := m.cache.Load(pc); ok {
+		return v.(int)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	v := m.match(frame.File)
+	m.cache.Store(pc, v)
+	return v
+}
+
+func (m *vmodule) match(file string) int {
+	file = strings.TrimSuffix(file, ".go")
+	for _, rule := range m.rules {
+		if matchpath(rule.pattern, file) {
+			return rule.v
+		}
+	}
+	return 0
+}
+
+// matchpath match pattern with as many trailing path components of
+// file as there are in pattern.
+func matchpath(pattern, file string) bool {
+	name, seps := file, strings.Count(pattern, "/")
+	for i := len(file) - 1; i >= 0; i-- {
+		if file[i] == '/' {
+			if seps--; seps < 0 {
+				name = file[i+1:]
+				break
+			}
+		}
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func (m *vmodule) String() string {
+	if m == nil {
+		return ""
+	}
+	ss := make([]string, 0, len(m.rules))
+	for _, rule := range m.rules {
+		ss = append(ss, rule.pattern+"="+strconv.Itoa(rule.v))
+	}
+	return strings.Join(ss, ",")
+}
@@ -0,0 +1,111 @@
+package log
+
+import "bytes"
+import "strings"
+import "testing"
+import stdlog "log"
+
+func TestVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	setts := map[string]interface{}{
+		"log.level": "info", "log.timeformat": "", "log.v": 1,
+	}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	V(0).Infof("zero")
+	V(1).Infof("one")
+	V(2).Infof("hidden")
+	V(1).Infow("fields", "n", 1)
+	ref := "[Infom] zero\n[Verbs] one\n[Verbs] fields n=1\n"
+	if s := buf.String(); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+
+	// verbosity implied by log.level.
+	logger.SetLogLevel("debug")
+	if !V(2).Enabled() || V(3).Enabled() {
+		t.Errorf("unexpected verbosity for debug level")
+	}
+	logger.SetLogLevel("trace")
+	if !V(10).Enabled() {
+		t.Errorf("unexpected verbosity for trace level")
+	}
+	logger.SetLogLevel("error")
+	if V(0).Enabled() || !V(1).Enabled() {
+		t.Errorf("unexpected verbosity for error level")
+	}
+
+	buf.Reset()
+	logger.SetLogFlags(stdlog.Lshortfile)
+	V(1).Infof("caller")
+	if s := buf.String(); !strings.HasPrefix(s, "verbose_test.go:") {
+		t.Errorf("unexpected %q", s)
+	}
+}
+
+func TestVmodule(t *testing.T) {
+	var buf bytes.Buffer
+	setts := map[string]interface{}{
+		"log.timeformat": "", "log.vmodule": "other=5,verbose_test=3",
+	}
+	logger, err := New(&buf, setts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLogger(logger, nil)
+	defer SetLogger(nil, Defaultsettings())
+
+	for i := 0; i < 3; i++ {
+		V(3).Infof("three")
+		V(4).Infof("hidden")
+	}
+	ref := "[Trace] three\n[Trace] three\n[Trace] three\n"
+	if s := buf.String(); s != ref {
+		t.Errorf("expected %q, got %q", ref, s)
+	}
+	n := 0
+	logger.(*defaultLogger).config().vmodule.cache.Range(
+		func(_, _ interface{}) bool { n++; return true })
+	if n != 2 {
+		t.Errorf("expected %v cached call sites, got %v", 2, n)
+	}
+	if s := Settings()["log.vmodule"]; s != "other=5,verbose_test=3" {
+		t.Errorf("unexpected %v", s)
+	}
+}
+
+func TestVmoduleMatch(t *testing.T) {
+	m, err := parsevmodule([]string{
+		"wal=3", "github.com/x/*/seg*=4", "storage/*=2", "*_test=1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		file string
+		v    int
+	}{
+		{"/src/app/storage/wal.go", 3},
+		{"/src/app/storage/index.go", 2},
+		{"/go/github.com/x/storage/segment.go", 4},
+		{"/go/github.com/y/storage2/segment.go", 0},
+		{"/src/app/main_test.go", 1},
+		{"main.go", 0},
+	}
+	for _, tc := range testcases {
+		if v := m.match(tc.file); v != tc.v {
+			t.Errorf("%v expected %v, got %v", tc.file, tc.v, v)
+		}
+	}
+
+	for _, item := range []string{"wal", "=2", "wal=x", "wal=-1", "[=1"} {
+		if _, err := parsevmodule([]string{item}); err == nil {
+			t.Errorf("expected error for %q", item)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package log
+
+import "os"
+import "fmt"
+import "sort"
+import "sync"
+import "time"
+import "reflect"
+import "strings"
+import "strconv"
+import "os/signal"
+
+// livesettings can be applied to a running logger, changes to other
+// parameters, like "log.file", re-create the default logger.
+var livesettings = map[string]bool{
+	"log.level": true, "log.levels": true, "log.flags": true,
+	"log.timeformat": true, "log.prefix": true, "log.format": true,
+	"log.levelname": true, "log.v": true, "log.vmodule": true,
+	"log.debugsites": true, "log.debugrules": true,
+	"log.colorignore": true, "log.colorfatal": true, "log.colorerror": true,
+	"log.colorwarn": true, "log.colorinfo": true, "log.colorverbose": true,
+	"log.colordebug": true, "log.colortrace": true,
+}
+
+// Watcher keep the default logger in sync with a settings file.
+type Watcher struct {
+	filename string
+	interval time.Duration
+
+	mu    sync.Mutex
+	setts map[string]interface{} // last applied settings.
+	mtime time.Time
+	size  int64
+
+	sigch    chan os.Signal
+	stopch   chan struct{}
+	stoponce sync.Once
+	done     chan struct{}
+}
+
+// Watch configure the default logger from filename, refer
+// SettingsFromFile(), and reload it whenever the file changes. File is
+// polled every interval, if interval is zero, reload happens only on
+// SIGHUP or by calling Reload(). On reload, changes to level, flags,
+// format, prefix and colors are applied to the running logger, other
+// changes re-create the default logger, refer Configure(). If the
+// file fails to load or validate, the old settings are kept and the
+// error is logged.
+func Watch(filename string, interval time.Duration) (*Watcher, error) {
+	w := &Watcher{
+		filename: filename, interval: interval,
+		stopch: make(chan struct{}), done: make(chan struct{}),
+	}
+	mtime, size, err := filestat(filename)
+	if err != nil {
+		return nil, err
+	}
+	setts, err := SettingsFromFile(filename)
+	if err != nil {
+		return nil, err
+	} else if err := Configure(setts); err != nil {
+		return nil, err
+	}
+	w.setts, w.mtime, w.size = setts, mtime, size
+
+	if sig, err := string2signal("SIGHUP"); err == nil {
+		w.sigch = make(chan os.Signal, 1)
+		signal.Notify(w.sigch, sig)
+	}
+	go w.run()
+	return w, nil
+}
+
+// Reload settings file and apply changes to the default logger.
+// Changed parameters are logged at warn level, such that reloads are
+// seen under the usual production levels, failures at error level.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if mtime, size, err := filestat(w.filename); err == nil {
+		w.mtime, w.size = mtime, size
+	}
+	setts, err := SettingsFromFile(w.filename)
+	if err == nil {
+		err = validate(setts)
+	}
+	if err != nil {
+		Errorf("log: keeping old settings, reload failed: %v\n", err)
+		return err
+	}
+
+	keys := diffsettings(w.setts, setts)
+	if len(keys) == 0 {
+		return nil
+	}
+	changed := make([]string, 0, len(keys))
+	deflog, live := getlog().(*defaultLogger)
+	for _, key := range keys {
+		live = live &&
+			(livesettings[key] || strings.HasPrefix(key, "log.levels."))
+		old, val := settingrepr(w.setts[key]), settingrepr(setts[key])
+		changed = append(changed, fmt.Sprintf("%v %v -> %v", key, old, val))
+	}
+	if live {
+		deflog.configure(setts)
+	} else if err := Configure(setts); err != nil {
+		Errorf("log: keeping old settings, reload failed: %v\n", err)
+		return err
+	}
+	w.setts = setts
+	Warnf("log: reloaded %v: %v\n", w.filename, strings.Join(changed, ", "))
+	return nil
+}
+
+// Close stop watching the settings file, the default logger is left
+// as is.
+func (w *Watcher) Close() error {
+	w.stoponce.Do(func() {
+		close(w.stopch)
+		if w.sigch != nil {
+			signal.Stop(w.sigch)
+		}
+	})
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	var tickch <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tickch = ticker.C
+	}
+	for {
+		select {
+		case <-w.stopch:
+			return
+		case <-w.sigch:
+			w.Reload()
+		case <-tickch:
+			if w.modified() {
+				w.Reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher) modified() bool {
+	mtime, size, err := filestat(w.filename)
+	if err != nil {
+		return false // file is being replaced, try next time.
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !mtime.Equal(w.mtime) || size != w.size
+}
+
+func filestat(filename string) (time.Time, int64, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return fi.ModTime(), fi.Size(), nil
+}
+
+// diffsettings return "log." parameters that differ between old and
+// setts, sorted.
+func diffsettings(old, setts map[string]interface{}) []string {
+	keys := []string{}
+	for key, value := range setts {
+		if !strings.HasPrefix(key, "log.") {
+			continue
+		} else if !reflect.DeepEqual(old[key], value) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range old {
+		if _, ok := setts[key]; !ok && strings.HasPrefix(key, "log.") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func settingrepr(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,128 @@
+package log
+
+import "os"
+import "sync"
+import "time"
+import "strings"
+import "testing"
+import "path/filepath"
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	conffile := filepath.Join(dir, "log.json")
+	writeconf := func(level string) {
+		data := `{"log": {"level": "` + level + `", "timeformat": "",` +
+			`"file": "` + logfile + `"}}`
+		// replace atomically, so that poll never reads partial file.
+		if err := os.WriteFile(conffile+".tmp", []byte(data), 0660); err != nil {
+			t.Fatal(err)
+		} else if err := os.Rename(conffile+".tmp", conffile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeconf("info")
+	w, err := Watch(conffile, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetLogger(nil, Defaultsettings())
+	defer w.Close()
+	logger := getlog()
+
+	Debugf("hidden")
+	writeconf("debug")
+	waitfor(t, func() bool { return Enabled(LogLevelDebug) })
+	Debugf("visible")
+	if getlog() != logger {
+		t.Errorf("expected level to be applied to the running logger")
+	}
+
+	// invalid settings are rejected, old settings are kept.
+	writeconf("loudest")
+	waitfor(t, func() bool {
+		data, _ := os.ReadFile(logfile)
+		return strings.Contains(string(data), "keeping old settings")
+	})
+	Debugf("still visible")
+
+	// reloads are logged even when info records are not.
+	writeconf("warn")
+	waitfor(t, func() bool {
+		data, _ := os.ReadFile(logfile)
+		return strings.Contains(string(data), `"debug" -> "warn"`)
+	})
+
+	data, _ := os.ReadFile(logfile)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	refs := []string{
+		`[Warng] log: reloaded ` + conffile +
+			`: log.level "info" -> "debug"`,
+		`[Debug] visible`,
+		`[Error] log: keeping old settings, reload failed:`,
+		`[Debug] still visible`,
+		`[Warng] log: reloaded ` + conffile +
+			`: log.level "debug" -> "warn"`,
+	}
+	if len(lines) != len(refs) {
+		t.Fatalf("unexpected %q", lines)
+	}
+	for i, ref := range refs {
+		if !strings.HasPrefix(lines[i], ref) {
+			t.Errorf("expected %q, got %q", ref, lines[i])
+		}
+	}
+}
+
+func TestWatchRecreate(t *testing.T) {
+	dir := t.TempDir()
+	conffile := filepath.Join(dir, "log.toml")
+	data := "[log]\ntimeformat = \"\"\nfile = \"" +
+		filepath.Join(dir, "a.log") + "\"\n"
+	if err := os.WriteFile(conffile, []byte(data), 0660); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Watch(conffile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetLogger(nil, Defaultsettings())
+	defer w.Close()
+	logger := getlog()
+
+	data = strings.Replace(data, "a.log", "b.log", 1)
+	if err := os.WriteFile(conffile, []byte(data), 0660); err != nil {
+		t.Fatal(err)
+	} else if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	} else if getlog() == logger {
+		t.Errorf("expected default logger to be re-created")
+	}
+	Infof("hello")
+	data2, _ := os.ReadFile(filepath.Join(dir, "b.log"))
+	if !strings.HasSuffix(string(data2), "[Infom] hello\n") {
+		t.Errorf("unexpected %q", data2)
+	}
+}
+
+func TestWatchCloseConcurrent(t *testing.T) {
+	conffile := filepath.Join(t.TempDir(), "log.ini")
+	if err := os.WriteFile(conffile, []byte("log.level = info\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Watch(conffile, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetLogger(nil, Defaultsettings())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Close()
+		}()
+	}
+	wg.Wait()
+}